@@ -8,15 +8,47 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"os"
+	"strings"
+	"syscall"
 	"time"
 )
 
+// MaxRetryDelay limits the exponential backoff between retries, unless RetryDelay itself is longer.
+const MaxRetryDelay = 30 * time.Second
+
+// errRequestSent marks a connection lost after the request was written, when the check might already be running.
+var errRequestSent = errors.New("connection lost after the request was sent")
+
 type RestAPI struct {
-	URL    string
-	Client *http.Client
-	Logger *slog.Logger
+	URL string
+	// Failover endpoints, tried in order when URL can not be reached.
+	Failover []string
+	// StateFile remembers the last healthy endpoint, which is tried first on the next check.
+	StateFile string
+	Client    *http.Client
+	Logger    *slog.Logger
+	// Retries after transient failures, like a refused connection while the service restarts.
+	Retries uint
+	// RetryDelay before the first retry, doubled for every further attempt.
+	RetryDelay time.Duration
+	// Aggregate all results of a response into one, instead of selecting the result of the command.
+	Aggregate bool
+}
+
+// APIStatusError is returned when the API answers with a status other than 200.
+type APIStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIStatusError) Error() string {
+	return fmt.Sprintf("API request not successful code=%d: %s", e.StatusCode, e.Body)
 }
 
 func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{}, timeout uint32) (*APICheckResult, error) { //nolint:lll
@@ -26,12 +58,109 @@ func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{},
 		return nil, fmt.Errorf("could not build JSON body: %w", err)
 	}
 
-	// With timeout
+	// With timeout, for all attempts together
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
 	defer cancel()
 
+	var attempt uint
+
+	for {
+		attempt++
+
+		result, err := a.executeEndpoints(ctx, command, body)
+		if err == nil {
+			a.Logger.Debug("API request successful", "attempts", attempt)
+
+			return result, nil
+		}
+
+		if attempt > a.Retries || !IsRetryableError(err) {
+			a.Logger.Debug("API request failed", "attempts", attempt, "error", err)
+
+			return nil, err
+		}
+
+		delay := a.retryDelay(attempt)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			a.Logger.Debug("no time left for a retry", "attempts", attempt, "error", err)
+
+			return nil, err
+		}
+
+		a.Logger.Debug("retrying API request", "attempt", attempt, "delay", delay, "error", err)
+
+		time.Sleep(delay)
+	}
+}
+
+// executeEndpoints tries all endpoints in order, until one of them can be reached.
+func (a RestAPI) executeEndpoints(ctx context.Context, command string, body []byte) (result *APICheckResult, err error) {
+	endpoints := a.Endpoints()
+
+	for _, endpoint := range endpoints {
+		result, err = a.executeRequest(ctx, endpoint, command, body)
+		if !IsConnectionError(err) {
+			if err == nil {
+				a.Logger.Debug("endpoint answered", "endpoint", endpoint)
+
+				if len(endpoints) > 1 {
+					a.rememberEndpoint(endpoint)
+				}
+			}
+
+			return
+		}
+
+		a.Logger.Debug("endpoint not reachable", "endpoint", endpoint, "error", err)
+	}
+
+	return
+}
+
+// Endpoints returns URL and Failover in order, starting with the last healthy endpoint from StateFile.
+func (a RestAPI) Endpoints() []string {
+	endpoints := append([]string{a.URL}, a.Failover...)
+
+	if len(endpoints) == 1 || a.StateFile == "" {
+		return endpoints
+	}
+
+	data, err := os.ReadFile(a.StateFile)
+	if err != nil {
+		return endpoints
+	}
+
+	healthy := strings.TrimSpace(string(data))
+
+	for i, endpoint := range endpoints {
+		if endpoint == healthy && i > 0 {
+			return append([]string{healthy}, append(endpoints[:i:i], endpoints[i+1:]...)...)
+		}
+	}
+
+	return endpoints
+}
+
+// rememberEndpoint stores the healthy endpoint in StateFile, errors are only logged.
+func (a RestAPI) rememberEndpoint(endpoint string) {
+	if a.StateFile == "" {
+		return
+	}
+
+	if data, err := os.ReadFile(a.StateFile); err == nil && strings.TrimSpace(string(data)) == endpoint {
+		return
+	}
+
+	err := os.WriteFile(a.StateFile, []byte(endpoint+"\n"), 0600)
+	if err != nil {
+		a.Logger.Debug("could not write state file", "path", a.StateFile, "error", err)
+	}
+}
+
+func (a RestAPI) executeRequest(ctx context.Context, endpoint, command string, body []byte) (*APICheckResult, error) {
 	// Build request
-	requestURL := a.URL + "/v1/checker?command=" + url.QueryEscape(command)
+	requestURL := checkerURL(endpoint, command)
 
 	a.Logger.Debug("sending request", "body", string(body), "url", requestURL)
 
@@ -42,6 +171,13 @@ func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{},
 
 	req.Header.Set("Content-Type", "application/json")
 
+	// Remember when the request is out, from then on it must not be sent again
+	var written bool
+
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) { written = info.Err == nil },
+	}))
+
 	// Execute request
 	resp, err := a.getClient().Do(req)
 
@@ -51,6 +187,10 @@ func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{},
 			return nil, fmt.Errorf("timeout during HTTP request: %w", err)
 		}
 
+		if written {
+			return nil, fmt.Errorf("executing API request failed: %w: %w", errRequestSent, err)
+		}
+
 		return nil, fmt.Errorf("executing API request failed: %w", err)
 	}
 
@@ -65,7 +205,7 @@ func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{},
 	a.Logger.Debug("received response", "body", string(resultBody))
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request not successful code=%d: %s", resp.StatusCode, string(resultBody))
+		return nil, &APIStatusError{StatusCode: resp.StatusCode, Body: string(resultBody)}
 	}
 
 	// Parse result
@@ -76,12 +216,74 @@ func (a RestAPI) ExecuteCheck(command string, arguments map[string]interface{},
 		return nil, fmt.Errorf("could not parse result JSON: %w", err)
 	}
 
-	// return first check result
-	for _, r := range result {
-		return &r, nil
+	if a.Aggregate {
+		return result.Aggregate()
+	}
+
+	return result.Select(command)
+}
+
+// checkerURL returns the URL executing command on endpoint.
+func checkerURL(endpoint, command string) string {
+	return endpoint + "/v1/checker?command=" + url.QueryEscape(command)
+}
+
+// retryDelay returns the exponential backoff for an attempt, with a random jitter of up to half the delay.
+//
+// The delay is limited to MaxRetryDelay, or RetryDelay when that is longer.
+func (a RestAPI) retryDelay(attempt uint) time.Duration {
+	limit := max(MaxRetryDelay, a.RetryDelay)
+	delay := a.RetryDelay
+
+	// doubling step by step can not overflow, unlike shifting by the attempt
+	for i := uint(1); i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+
+	delay = min(delay, limit)
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) // nolint:gosec // no need for secure randomness
+}
+
+// IsRetryableError returns true for failures that are worth another attempt,
+// which are connection failures and the gateway errors 502, 503 and 504.
+func IsRetryableError(err error) bool {
+	var statusErr *APIStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+
+		return false
+	}
+
+	return IsConnectionError(err)
+}
+
+// IsConnectionError returns true when the API could not be reached at all,
+// like a refused or reset connection. Timeouts are not connection errors,
+// neither is a connection lost after the request was sent, since the check must not be executed twice.
+func IsConnectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errRequestSent) {
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	// The daemon could not reach the API
+	var daemonErr *DaemonError
+	if errors.As(err, &daemonErr) {
+		return daemonErr.Class == DaemonErrorConnection
 	}
 
-	return nil, fmt.Errorf("no check result in API response")
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
 }
 
 func (a *RestAPI) getClient() *http.Client {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkerListPath lists all checks available via the checker endpoint of the REST API.
+const checkerListPath = "/v1/checker?list"
+
+// APICheckCommand is a check available via the REST API.
+type APICheckCommand struct {
+	Name       string              `json:"name"`
+	Parameters []APICheckParameter `json:"parameters"`
+}
+
+// APICheckParameter is a parameter of an APICheckCommand.
+type APICheckParameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ListChecks returns all checks available via the REST API, sorted by name.
+//
+// Endpoints are tried in order, like for ExecuteCheck, but without retries.
+func (a RestAPI) ListChecks(timeout uint32) (commands []APICheckCommand, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	for _, endpoint := range a.Endpoints() {
+		commands, err = a.listChecks(ctx, endpoint)
+		if !IsConnectionError(err) {
+			return
+		}
+
+		a.Logger.Debug("endpoint not reachable", "endpoint", endpoint, "error", err)
+	}
+
+	return
+}
+
+func (a RestAPI) listChecks(ctx context.Context, endpoint string) ([]APICheckCommand, error) {
+	requestURL := endpoint + checkerListPath
+
+	a.Logger.Debug("sending request", "url", requestURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not build request: %w", err)
+	}
+
+	resp, err := a.getClient().Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("timeout during HTTP request: %w", err)
+		}
+
+		return nil, fmt.Errorf("executing API request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read result: %w", err)
+	}
+
+	a.Logger.Debug("received response", "body", string(data))
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	return ParseAPICheckCommands(data)
+}
+
+// ParseAPICheckCommands parses the check listing of the REST API, an object with the commands as keys:
+//
+//	{"Invoke-IcingaCheckCPU": {"parameters": [{"name": "Warning", "type": "Object", "required": false, "description": "..."}]}}
+//
+// Commands are sorted by name, parameters are kept in the order of the API.
+func ParseAPICheckCommands(data []byte) ([]APICheckCommand, error) {
+	var listing map[string]struct {
+		Parameters []APICheckParameter `json:"parameters"`
+	}
+
+	err := json.Unmarshal(data, &listing)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse check list JSON: %w", err)
+	}
+
+	commands := make([]APICheckCommand, 0, len(listing))
+
+	for name, entry := range listing {
+		parameters := entry.Parameters
+		if parameters == nil {
+			parameters = []APICheckParameter{}
+		}
+
+		commands = append(commands, APICheckCommand{Name: name, Parameters: parameters})
+	}
+
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+
+	return commands, nil
+}
+
+// WriteAPICheckCommands writes commands with their parameters as text, or as JSON with the json output format.
+func WriteAPICheckCommands(w io.Writer, format string, commands []APICheckCommand) error {
+	if format == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(commands)
+	}
+
+	var s strings.Builder
+
+	for _, command := range commands {
+		s.WriteString(command.Name + "\n")
+
+		for _, parameter := range command.Parameters {
+			s.WriteString("    " + parameter.Name)
+
+			if parameter.Type != "" {
+				s.WriteString(" <" + parameter.Type + ">")
+			}
+
+			if parameter.Required {
+				s.WriteString(" (required)")
+			}
+
+			if parameter.Description != "" {
+				s.WriteString(" - " + parameter.Description)
+			}
+
+			s.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, s.String())
+
+	return err
+}
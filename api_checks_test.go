@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPICheckCommands(t *testing.T) {
+	data, err := os.ReadFile("testdata/api/checker-list.json")
+	assert.NoError(t, err)
+
+	commands, err := ParseAPICheckCommands(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []APICheckCommand{
+		{Name: "Invoke-IcingaCheckCPU", Parameters: []APICheckParameter{
+			{Name: "Warning", Type: "Object", Description: "Used to specify a Warning threshold."},
+			{Name: "Critical", Type: "Object", Description: "Used to specify a Critical threshold."},
+			{Name: "Core", Type: "String", Description: "Used to specify a single core to check for."},
+			{Name: "NoPerfData", Type: "SwitchParameter"},
+		}},
+		{Name: "Invoke-IcingaCheckService", Parameters: []APICheckParameter{
+			{Name: "Service", Type: "Array", Required: true,
+				Description: "Used to specify an array of services which should be checked against the status."},
+			{Name: "Status", Type: "String", Description: "Status for the specified service or services to check against."},
+		}},
+		{Name: "Invoke-IcingaCheckUptime", Parameters: []APICheckParameter{}},
+	}, commands)
+
+	commands, err = ParseAPICheckCommands([]byte(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []APICheckCommand{}, commands)
+
+	for _, invalid := range []string{`"broken"`, `["Invoke-IcingaCheckCPU"]`, `{"Invoke-IcingaCheckCPU": {"parameters": ["Warning"]}}`} {
+		_, err = ParseAPICheckCommands([]byte(invalid))
+		assert.ErrorContains(t, err, "could not parse check list JSON", invalid)
+	}
+}
+
+func TestRestAPIListChecks(t *testing.T) {
+	data, err := os.ReadFile("testdata/api/checker-list.json")
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "/v1/checker", r.URL.Path)
+		assert.True(t, r.URL.Query().Has("list"))
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	api := RestAPI{URL: down.URL, Failover: []string{srv.URL}, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	commands, err := api.ListChecks(10)
+	assert.NoError(t, err)
+	assert.Len(t, commands, 3)
+
+	var output bytes.Buffer
+
+	assert.NoError(t, WriteAPICheckCommands(&output, OutputPlugin, commands[1:2]))
+	assert.Equal(t, "Invoke-IcingaCheckService\n"+
+		"    Service <Array> (required) - Used to specify an array of services which should be checked against the status.\n"+
+		"    Status <String> - Status for the specified service or services to check against.\n", output.String())
+
+	output.Reset()
+
+	assert.NoError(t, WriteAPICheckCommands(&output, OutputJSON, commands[2:]))
+	assert.JSONEq(t, `[{"name": "Invoke-IcingaCheckUptime", "parameters": []}]`, output.String())
+}
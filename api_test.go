@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -91,3 +98,327 @@ func TestApiTimeout(t *testing.T) {
 		t.Error("\nActual: ", actual, "\nExpected: ", expected)
 	}
 }
+
+func TestApiRequestBody(t *testing.T) {
+	var body string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckService": {"exitcode": 0, "checkresult": "[OK] Service", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	api := RestAPI{URL: srv.URL, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	command, args := GetPowershellArgs([]string{
+		"-C", "Invoke-IcingaCheckService", "-Service", "@{ Name = 'W32Time'; Status = @('Running') }"})
+
+	_, err := api.ExecuteCheck(command, args, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"-Service":{"Name":"W32Time","Status":["Running"]}}`
+
+	if body != expected {
+		t.Error("\nActual: ", body, "\nExpected: ", expected)
+	}
+}
+
+func TestApiRetry(t *testing.T) {
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckFoo": {"exitcode": 0, "checkresult": "[OK] \"foo\"", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	api := RestAPI{
+		URL:        srv.URL,
+		Logger:     slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Retries:    3,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	result, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CheckResult != "[OK] \"foo\"" || requests != 3 {
+		t.Error("\nActual: ", result.CheckResult, requests, "\nExpected: ", "[OK] \"foo\"", 3)
+	}
+}
+
+func TestApiRetryNotRetryable(t *testing.T) {
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	api := RestAPI{URL: srv.URL, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil)), Retries: 3}
+
+	_, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if err == nil || requests != 1 {
+		t.Error("\nActual: ", err, requests, "\nExpected: error after 1 request")
+	}
+}
+
+func TestApiRetryConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+
+	api := RestAPI{
+		URL:        srv.URL,
+		Logger:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Retries:    2,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	_, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if err == nil || !IsRetryableError(err) {
+		t.Error("\nActual: ", err, "\nExpected: retryable connection error")
+	}
+
+	// No retry when the delay exceeds the timeout budget
+	api.RetryDelay = time.Minute
+	start := time.Now()
+
+	_, err = api.ExecuteCheck("command", map[string]interface{}{}, 1)
+	if err == nil || time.Since(start) > time.Second {
+		t.Error("\nActual: ", err, time.Since(start), "\nExpected: error without waiting")
+	}
+}
+
+func TestApiRetryDelay(t *testing.T) {
+	api := RestAPI{RetryDelay: 500 * time.Millisecond}
+
+	for _, test := range []struct {
+		attempt  uint
+		min, max time.Duration
+	}{
+		{1, 250 * time.Millisecond, 500 * time.Millisecond},
+		{3, time.Second, 2 * time.Second},
+		{64, MaxRetryDelay / 2, MaxRetryDelay},
+		{1000, MaxRetryDelay / 2, MaxRetryDelay},
+	} {
+		if delay := api.retryDelay(test.attempt); delay < test.min || delay > test.max {
+			t.Error("\nActual: ", delay, "\nExpected: between ", test.min, test.max, "for attempt", test.attempt)
+		}
+	}
+
+	// A longer configured delay is kept
+	api.RetryDelay = time.Hour
+
+	if delay := api.retryDelay(100); delay < 30*time.Minute || delay > time.Hour {
+		t.Error("\nActual: ", delay, "\nExpected: at most 1h")
+	}
+}
+
+func TestApiRetryConnectionResetAfterRequest(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		// Reset the connection after the request has been read
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		_ = conn.(*net.TCPConn).SetLinger(0)
+		_ = conn.Close()
+	}))
+	defer srv.Close()
+
+	api := RestAPI{
+		URL:        srv.URL,
+		Failover:   []string{srv.URL},
+		Logger:     slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		Retries:    3,
+		RetryDelay: 10 * time.Millisecond,
+	}
+
+	_, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if !errors.Is(err, errRequestSent) || IsConnectionError(err) || requests.Load() != 1 {
+		t.Error("\nActual: ", err, requests.Load(), "\nExpected: no retry and no failover after 1 request")
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	testcases := []struct {
+		err      error
+		expected bool
+	}{
+		{&APIStatusError{StatusCode: http.StatusBadGateway}, true},
+		{&APIStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&APIStatusError{StatusCode: http.StatusGatewayTimeout}, true},
+		{&APIStatusError{StatusCode: http.StatusInternalServerError}, false},
+		{&APIStatusError{StatusCode: http.StatusNotFound}, false},
+		{fmt.Errorf("executing API request failed: %w", syscall.ECONNRESET), true},
+		{fmt.Errorf("executing API request failed: %w: %w", errRequestSent, syscall.ECONNRESET), false},
+		{fmt.Errorf("executing API request failed: %w", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), true},
+		{fmt.Errorf("timeout during HTTP request: %w", context.DeadlineExceeded), false},
+		{fmt.Errorf("could not parse result JSON"), false},
+	}
+
+	for _, test := range testcases {
+		if actual := IsRetryableError(test.err); actual != test.expected {
+			t.Error("\nActual: ", actual, "\nExpected: ", test.expected, test.err)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	if !IsConnectionError(fmt.Errorf("executing API request failed: %w", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})) {
+		t.Error("Expected dial error to be a connection error")
+	}
+
+	if IsConnectionError(&APIStatusError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Error("Expected status error not to be a connection error")
+	}
+
+	if IsConnectionError(fmt.Errorf("timeout during HTTP request: %w", context.DeadlineExceeded)) {
+		t.Error("Expected timeout not to be a connection error")
+	}
+}
+
+func TestApiFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckFoo": {"exitcode": 0, "checkresult": "[OK] \"foo\"", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	stateFile := t.TempDir() + "/connector.state"
+
+	api := RestAPI{
+		URL:       down.URL,
+		Failover:  []string{srv.URL},
+		StateFile: stateFile,
+		Logger:    slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	if endpoints := api.Endpoints(); endpoints[0] != down.URL {
+		t.Error("\nActual: ", endpoints, "\nExpected: ", down.URL, "first")
+	}
+
+	result, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.CheckResult != "[OK] \"foo\"" {
+		t.Error("\nActual: ", result.CheckResult, "\nExpected: ", "[OK] \"foo\"")
+	}
+
+	// The healthy endpoint is remembered and tried first
+	state, _ := os.ReadFile(stateFile)
+	if strings.TrimSpace(string(state)) != srv.URL {
+		t.Error("\nActual: ", string(state), "\nExpected: ", srv.URL)
+	}
+
+	if endpoints := api.Endpoints(); len(endpoints) != 2 || endpoints[0] != srv.URL || endpoints[1] != down.URL {
+		t.Error("\nActual: ", endpoints, "\nExpected: ", srv.URL, down.URL)
+	}
+
+}
+
+func TestApiFailoverAPIError(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusInternalServerError, http.StatusServiceUnavailable} {
+		var failoverRequests int
+
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(`broken`))
+		}))
+
+		failover := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			failoverRequests++
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"Invoke-IcingaCheckFoo": {"exitcode": 0, "checkresult": "[OK] \"foo\"", "perfdata": {}}}`))
+		}))
+
+		api := RestAPI{
+			URL:      failing.URL,
+			Failover: []string{failover.URL},
+			Logger:   slog.New(slog.NewTextHandler(os.Stdout, nil)),
+		}
+
+		// No failover for API errors, the API is reachable
+		_, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+
+		var statusErr *APIStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != status || failoverRequests != 0 {
+			t.Error("\nActual: ", err, failoverRequests, "\nExpected: ", status, "without failover request")
+		}
+
+		failing.Close()
+		failover.Close()
+	}
+}
+
+func TestApiFailoverAllDown(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	down2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down2.Close()
+
+	api := RestAPI{
+		URL:      down.URL,
+		Failover: []string{down2.URL},
+		Logger:   slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+
+	_, err := api.ExecuteCheck("command", map[string]interface{}{}, 10)
+	if !IsConnectionError(err) {
+		t.Error("\nActual: ", err, "\nExpected: connection error")
+	}
+}
+
+func TestApiMultipleResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckA": {"exitcode": 1, "checkresult": "[WARNING] A", "perfdata": ["'a'=1"]},` +
+			`"Invoke-IcingaCheckB": {"exitcode": 0, "checkresult": "[OK] B", "perfdata": ["'b'=2"]}}`))
+	}))
+	defer srv.Close()
+
+	api := RestAPI{URL: srv.URL, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	for i := 0; i < 10; i++ {
+		result, err := api.ExecuteCheck("Invoke-IcingaCheckB", map[string]interface{}{}, 10)
+		if err != nil || result.CheckResult != "[OK] B" {
+			t.Fatal("\nActual: ", result, err, "\nExpected: ", "[OK] B")
+		}
+	}
+
+	api.Aggregate = true
+
+	result, err := api.ExecuteCheck("Invoke-IcingaCheckB", map[string]interface{}{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[WARNING] A\n[OK] B\n| a=1 b=2\n"
+	if result.String() != expected || result.ExitCode != 1 {
+		t.Error("\nActual: ", result.String(), "\nExpected: ", expected)
+	}
+}
@@ -3,7 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+
+	checkresult "github.com/NETWAYS/go-check/result"
 )
 
 type APICheckResults map[string]APICheckResult
@@ -14,26 +20,135 @@ type APICheckResult struct {
 	ExitCode    int
 	CheckResult string
 	Perfdata    APIPerfdataList
+
+	// parsedPerfdata of ParsedPerfdata, so all outputs of a result share a single parse.
+	parsedPerfdata PerfdataList
 }
 
-func (r APICheckResult) String() string {
-	var s strings.Builder
+// ErrNoCheckResult is returned when the API response contains no usable check result.
+var ErrNoCheckResult = errors.New("no check result in API response")
 
-	s.WriteString(strings.TrimSpace(r.CheckResult))
+// Select the result of command, matching the key case-insensitive.
+//
+// When there is only a single result, it is returned no matter its key.
+func (r APICheckResults) Select(command string) (*APICheckResult, error) {
+	if result, ok := r[command]; ok {
+		return &result, nil
+	}
+
+	for _, name := range r.Names() {
+		if strings.EqualFold(name, command) {
+			result := r[name]
+			return &result, nil
+		}
+	}
+
+	if len(r) == 1 {
+		for _, result := range r {
+			return &result, nil
+		}
+	}
+
+	if len(r) == 0 {
+		return nil, ErrNoCheckResult
+	}
 
-	if len(r.Perfdata) > 0 {
-		s.WriteString("\n|")
+	return nil, fmt.Errorf("%w for %s, found: %s", ErrNoCheckResult, command, strings.Join(r.Names(), ", "))
+}
 
-		for _, p := range r.Perfdata {
-			s.WriteString(" " + strings.TrimSpace(p))
+// Aggregate all results into a single one, with the worst state as exit code and all perfdata combined.
+//
+// The result with the worst state comes first, so it is the short output in Icinga, the others are ordered by name.
+func (r APICheckResults) Aggregate() (*APICheckResult, error) {
+	if len(r) == 0 {
+		return nil, ErrNoCheckResult
+	}
+
+	names := r.Names()
+	states := make([]int, 0, len(names))
+
+	for _, name := range names {
+		states = append(states, r[name].ExitCode)
+	}
+
+	worst := checkresult.WorstState(states...)
+
+	// Move the first result with the worst state to the front
+	for i, name := range names {
+		if r[name].ExitCode == worst {
+			names = append([]string{name}, append(names[:i:i], names[i+1:]...)...)
+			break
 		}
 	}
 
+	outputs := make([]string, 0, len(names))
+	aggregated := &APICheckResult{ExitCode: worst, Perfdata: APIPerfdataList{}}
+
+	for _, name := range names {
+		result := r[name]
+
+		outputs = append(outputs, strings.TrimSpace(result.CheckResult))
+		aggregated.Perfdata = append(aggregated.Perfdata, result.Perfdata...)
+	}
+
+	aggregated.CheckResult = strings.Join(outputs, "\n")
+
+	return aggregated, nil
+}
+
+// Names of all results, sorted.
+func (r APICheckResults) Names() []string {
+	names := make([]string, 0, len(r))
+
+	for name := range r {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (r *APICheckResult) String() string {
+	var s strings.Builder
+
+	s.WriteString(strings.TrimSpace(r.CheckResult))
+
+	if perfdata := r.ParsedPerfdata(); len(perfdata) > 0 {
+		s.WriteString("\n| " + perfdata.String())
+	}
+
 	s.WriteString("\n")
 
 	return s.String()
 }
 
+// ParsedPerfdata returns the valid entries of Perfdata, parsed on the first call and kept with the result.
+func (r *APICheckResult) ParsedPerfdata() PerfdataList {
+	if r.parsedPerfdata == nil {
+		r.parsedPerfdata = r.Perfdata.Parse()
+		if r.parsedPerfdata == nil {
+			r.parsedPerfdata = PerfdataList{}
+		}
+	}
+
+	return r.parsedPerfdata
+}
+
+// Parse all perfdata, invalid entries are dropped with a warning.
+func (p APIPerfdataList) Parse() (list PerfdataList) {
+	for _, entry := range p {
+		parsed, errs := ParsePerfdataList(entry)
+		for _, err := range errs {
+			slog.Warn("dropping invalid perfdata", "error", err)
+		}
+
+		list = append(list, parsed...)
+	}
+
+	return
+}
+
 // UnmarshalJSON makes sure we can de-serialize JSON.
 //
 // The API can return {} when no perfdata is set.
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,9 +33,17 @@ func TestAPIPerfdataList_String(t *testing.T) {
 			result: APICheckResult{
 				ExitCode:    1,
 				CheckResult: "foo",
-				Perfdata:    APIPerfdataList{"a", "b", "c"},
+				Perfdata:    APIPerfdataList{"a=1", "'b c'=2%;80;90", "c=3"},
 			},
-			expected: "foo\n| a b c\n",
+			expected: "foo\n| a=1 'b c'=2%;80;90 c=3\n",
+		},
+		{
+			result: APICheckResult{
+				ExitCode:    1,
+				CheckResult: "foo",
+				Perfdata:    APIPerfdataList{"'a'=1", "b", "c=x"},
+			},
+			expected: "foo\n| a=1\n",
 		},
 		{
 			result: APICheckResult{
@@ -46,3 +58,84 @@ func TestAPIPerfdataList_String(t *testing.T) {
 		assert.Equal(t, test.expected, test.result.String())
 	}
 }
+
+func TestAPICheckResults_Select(t *testing.T) {
+	results := APICheckResults{
+		"Invoke-IcingaCheckCPU":    {ExitCode: 0, CheckResult: "cpu"},
+		"Invoke-IcingaCheckMemory": {ExitCode: 1, CheckResult: "memory"},
+	}
+
+	result, err := results.Select("Invoke-IcingaCheckMemory")
+	assert.NoError(t, err)
+	assert.Equal(t, "memory", result.CheckResult)
+
+	result, err = results.Select("invoke-icingacheckcpu")
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu", result.CheckResult)
+
+	_, err = results.Select("Invoke-IcingaCheckDisk")
+	assert.ErrorIs(t, err, ErrNoCheckResult)
+	assert.ErrorContains(t, err, "found: Invoke-IcingaCheckCPU, Invoke-IcingaCheckMemory")
+
+	// A single result is used, whatever its name
+	result, err = APICheckResults{"Other": {CheckResult: "other"}}.Select("Invoke-IcingaCheckDisk")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", result.CheckResult)
+
+	_, err = APICheckResults{}.Select("Invoke-IcingaCheckDisk")
+	assert.ErrorIs(t, err, ErrNoCheckResult)
+}
+
+func TestAPICheckResults_Aggregate(t *testing.T) {
+	results := APICheckResults{
+		"Invoke-IcingaCheckMemory": {ExitCode: 3, CheckResult: "[UNKNOWN] memory\n", Perfdata: APIPerfdataList{"'mem'=1"}},
+		"Invoke-IcingaCheckCPU":    {ExitCode: 2, CheckResult: "[CRITICAL] cpu", Perfdata: APIPerfdataList{"'cpu'=2", "'core'=3"}},
+		"Invoke-IcingaCheckDisk":   {ExitCode: 1, CheckResult: "[WARNING] disk", Perfdata: APIPerfdataList{}},
+	}
+
+	result, err := results.Aggregate()
+	assert.NoError(t, err)
+	assert.Equal(t, &APICheckResult{
+		ExitCode:    2,
+		CheckResult: "[CRITICAL] cpu\n[WARNING] disk\n[UNKNOWN] memory",
+		Perfdata:    APIPerfdataList{"'cpu'=2", "'core'=3", "'mem'=1"},
+	}, result)
+
+	// The worst state comes first, no matter its name
+	results["Invoke-IcingaCheckMemory"] = APICheckResult{ExitCode: 2, CheckResult: "[CRITICAL] memory"}
+	results["Invoke-IcingaCheckCPU"] = APICheckResult{ExitCode: 0, CheckResult: "[OK] cpu"}
+
+	result, err = results.Aggregate()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.ExitCode)
+	assert.Equal(t, "[CRITICAL] memory\n[OK] cpu\n[WARNING] disk", result.CheckResult)
+
+	delete(results, "Invoke-IcingaCheckMemory")
+	results["Invoke-IcingaCheckUptime"] = APICheckResult{ExitCode: 3, CheckResult: "[UNKNOWN] uptime"}
+
+	result, err = results.Aggregate()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "[UNKNOWN] uptime\n[OK] cpu\n[WARNING] disk", result.CheckResult)
+
+	_, err = APICheckResults{}.Aggregate()
+	assert.ErrorIs(t, err, ErrNoCheckResult)
+}
+
+func TestAPICheckResult_ParsedPerfdata(t *testing.T) {
+	var logs bytes.Buffer
+
+	defer slog.SetDefault(slog.Default())
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+
+	result := &APICheckResult{ExitCode: 1, CheckResult: "[WARNING] CPU", Perfdata: APIPerfdataList{"'load'=90%", "broken"}}
+	assert.Equal(t, "[WARNING] CPU\n| load=90%\n", result.String())
+
+	// Parsed once, for all outputs
+	_ = Submitter{Service: "cpu"}.NewProcessCheckResult(result)
+
+	assert.NoError(t, ResultWriter{Format: OutputJSON}.Write(io.Discard, result))
+	assert.Equal(t, 1, strings.Count(logs.String(), "level=WARN msg=\"dropping invalid perfdata\""))
+	assert.Equal(t, "load=90%", result.ParsedPerfdata().String())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/NETWAYS/go-check"
+)
+
+const (
+	BatchFormatJSON      = "json"
+	BatchFormatNetstring = "netstring"
+)
+
+// BatchRequest is a single check to execute in batch mode.
+type BatchRequest struct {
+	ID        string                 `json:"id,omitempty"`
+	Command   string                 `json:"command"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// BatchResult is the result of a BatchRequest, Error is set when the check could not be executed.
+//
+// The result has the same fields as a single check with --output json.
+type BatchResult struct {
+	ID      string `json:"id,omitempty"`
+	Command string `json:"command"`
+	CheckResultOutput
+	Error string `json:"error,omitempty"`
+}
+
+// RunBatch executes all requests concurrently with a limited number of workers.
+//
+// Results are returned in the order of the requests.
+func RunBatch(api CheckExecutor, requests []BatchRequest, workers int, timeout uint32) []BatchResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(requests))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range queue {
+				results[i] = executeBatchRequest(api, requests[i], timeout)
+			}
+		}()
+	}
+
+	for i := range requests {
+		queue <- i
+	}
+
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+func executeBatchRequest(api CheckExecutor, request BatchRequest, timeout uint32) BatchResult {
+	batchResult := BatchResult{ID: request.ID, Command: request.Command}
+	batchResult.Perfdata = PerfdataList{}
+
+	if request.Command == "" {
+		batchResult.ExitCode = check.Unknown
+		batchResult.Error = ErrNoCommand.Error()
+
+		return batchResult
+	}
+
+	arguments := request.Arguments
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+
+	result, err := api.ExecuteCheck(request.Command, arguments, timeout)
+	if err != nil {
+		batchResult.ExitCode = check.Unknown
+		batchResult.Error = err.Error()
+
+		return batchResult
+	}
+
+	batchResult.CheckResultOutput = NewCheckResultOutput(result)
+
+	return batchResult
+}
+
+// ReadBatchRequests reads requests from r, as JSON array or as JSON objects framed by netstrings.
+func ReadBatchRequests(r io.Reader, format string) (requests []BatchRequest, err error) {
+	switch format {
+	case BatchFormatJSON:
+		err = json.NewDecoder(r).Decode(&requests)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse batch requests: %w", err)
+		}
+	case BatchFormatNetstring:
+		reader := NewNetstringReader(r)
+
+		for {
+			data, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("could not read batch request %d: %w", len(requests)+1, err)
+			}
+
+			var request BatchRequest
+
+			err = json.Unmarshal(data, &request)
+			if err != nil {
+				return nil, fmt.Errorf("could not parse batch request %d: %w", len(requests)+1, err)
+			}
+
+			requests = append(requests, request)
+		}
+	default:
+		return nil, fmt.Errorf("unknown batch format: %s", format)
+	}
+
+	return requests, nil
+}
+
+// WriteBatchResults writes results to w, in the same format the requests were read.
+func WriteBatchResults(w io.Writer, format string, results []BatchResult) error {
+	switch format {
+	case BatchFormatJSON:
+		return json.NewEncoder(w).Encode(results)
+	case BatchFormatNetstring:
+		writer := NewNetstringWriter(w)
+
+		for _, result := range results {
+			data, err := json.Marshal(result)
+			if err != nil {
+				return fmt.Errorf("could not build batch result: %w", err)
+			}
+
+			err = writer.Write(data)
+			if err != nil {
+				return err
+			}
+		}
+
+		return writer.Flush()
+	}
+
+	return fmt.Errorf("unknown batch format: %s", format)
+}
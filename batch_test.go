@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBatchRequests(t *testing.T) {
+	requests, err := ReadBatchRequests(strings.NewReader(`[
+		{"id": "cpu", "command": "Invoke-IcingaCheckCPU", "arguments": {"-Warning": 80}},
+		{"command": "Invoke-IcingaCheckUptime"}
+	]`), BatchFormatJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []BatchRequest{
+		{ID: "cpu", Command: "Invoke-IcingaCheckCPU", Arguments: map[string]interface{}{"-Warning": float64(80)}},
+		{Command: "Invoke-IcingaCheckUptime"},
+	}, requests)
+
+	input := bytes.NewBufferString(`49:{"id": "cpu", "command": "Invoke-IcingaCheckCPU"},` + "\n" +
+		`39:{"command": "Invoke-IcingaCheckUptime"},`)
+
+	requests, err = ReadBatchRequests(input, BatchFormatNetstring)
+	assert.NoError(t, err)
+	assert.Equal(t, []BatchRequest{
+		{ID: "cpu", Command: "Invoke-IcingaCheckCPU"},
+		{Command: "Invoke-IcingaCheckUptime"},
+	}, requests)
+
+	_, err = ReadBatchRequests(strings.NewReader(`5:hello,`), BatchFormatNetstring)
+	assert.ErrorContains(t, err, "could not parse batch request 1")
+
+	_, err = ReadBatchRequests(strings.NewReader(`[]`), "xml")
+	assert.ErrorContains(t, err, "unknown batch format")
+}
+
+func TestRunBatch(t *testing.T) {
+	var running, maxRunning int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		command := r.URL.Query().Get("command")
+		if command == "Invoke-IcingaCheckBroken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`broken`))
+
+			return
+		}
+
+		if command == "Invoke-IcingaCheckCPU" {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"` + command + `": {"exitcode": 0, "checkresult": "[OK] ` + command + `\n", "perfdata": ["'load'=10.00%;80;90", "broken"]}}`))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"` + command + `": {"exitcode": 0, "checkresult": "[OK] ` + command + `\n", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	api := RestAPI{URL: srv.URL, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	requests := []BatchRequest{
+		{ID: "1", Command: "Invoke-IcingaCheckCPU"},
+		{ID: "2", Command: "Invoke-IcingaCheckBroken"},
+		{ID: "3", Command: ""},
+		{ID: "4", Command: "Invoke-IcingaCheckUptime"},
+		{ID: "5", Command: "Invoke-IcingaCheckMemory"},
+	}
+
+	results := RunBatch(api, requests, 2, 10)
+
+	assert.Equal(t, []BatchResult{
+		// perfdata like for a single check
+		{ID: "1", Command: "Invoke-IcingaCheckCPU", CheckResultOutput: CheckResultOutput{
+			Output:   "[OK] Invoke-IcingaCheckCPU",
+			Perfdata: PerfdataList{{Label: "load", Value: float(10), UOM: "%", Warn: "80", Crit: "90"}},
+		}},
+		{ID: "2", Command: "Invoke-IcingaCheckBroken", CheckResultOutput: CheckResultOutput{ExitCode: 3, Perfdata: PerfdataList{}},
+			Error: "API request not successful code=500: broken"},
+		{ID: "3", CheckResultOutput: CheckResultOutput{ExitCode: 3, Perfdata: PerfdataList{}}, Error: ErrNoCommand.Error()},
+		{ID: "4", Command: "Invoke-IcingaCheckUptime", CheckResultOutput: CheckResultOutput{
+			Output: "[OK] Invoke-IcingaCheckUptime", Perfdata: PerfdataList{}}},
+		{ID: "5", Command: "Invoke-IcingaCheckMemory", CheckResultOutput: CheckResultOutput{
+			Output: "[OK] Invoke-IcingaCheckMemory", Perfdata: PerfdataList{}}},
+	}, results)
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(2))
+}
+
+func TestWriteBatchResults(t *testing.T) {
+	results := []BatchResult{
+		{ID: "1", Command: "Invoke-IcingaCheckCPU", CheckResultOutput: CheckResultOutput{
+			Output: "[OK] CPU", Perfdata: PerfdataList{{Label: "load", Value: float(10), UOM: "%"}}}},
+		{ID: "2", Command: "Invoke-IcingaCheckBroken", CheckResultOutput: CheckResultOutput{ExitCode: 3, Perfdata: PerfdataList{}},
+			Error: "failed"},
+	}
+
+	var output bytes.Buffer
+
+	err := WriteBatchResults(&output, BatchFormatJSON, results)
+	assert.NoError(t, err)
+
+	// Same fields as --output json
+	assert.Contains(t, output.String(), `"exit_code":0,"output":"[OK] CPU","perfdata":[{"label":"load","value":10,"uom":"%"}]`)
+
+	var decoded []BatchResult
+
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	assert.Equal(t, results, decoded)
+
+	output.Reset()
+
+	err = WriteBatchResults(&output, BatchFormatNetstring, results)
+	assert.NoError(t, err)
+
+	reader := NewNetstringReader(&output)
+
+	for _, result := range results {
+		data, err := reader.Read()
+		assert.NoError(t, err)
+
+		var decoded BatchResult
+
+		assert.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, result, decoded)
+	}
+}
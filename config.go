@@ -4,27 +4,61 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	flag "github.com/spf13/pflag"
 )
 
 const (
-	DefaultAPI  = "https://localhost:5668"
-	ProgramName = "icinga-powershell-connector"
+	DefaultAPI       = "https://localhost:5668"
+	DefaultStateFile = IcingaStatePrefix + "/cache/icinga2/powershell-connector.state"
+	ProgramName      = "icinga-powershell-connector"
 )
 
 type Config struct {
-	API          string
-	Command      string
-	CertName     string
-	CAFile       string
-	Arguments    map[string]interface{}
-	Timeout      uint32
-	Insecure     bool
-	Debug        bool
-	PrintVersion bool
+	API                 string
+	Command             string
+	CertName            string
+	CAFile              string
+	CertFile            string
+	KeyFile             string
+	Socket              string
+	ConfigFile          string
+	FrameworkConfig     string
+	StateFile           string
+	FallbackCommand     string
+	BatchFormat         string
+	Output              string
+	SubmitAPI           string
+	SubmitHost          string
+	SubmitService       string
+	SubmitCertName      string
+	CheckSource         string
+	Icinga              IcingaPaths
+	Arguments           map[string]interface{}
+	PowerShellArguments []string // unmodified, for the fallback command
+	AllowCommands       []string
+	DenyCommands        []string
+	Timeout             uint32
+	Workers             int
+	Retries             uint
+	RetryDelay          time.Duration
+	Insecure            bool
+	Debug               bool
+	PrintVersion        bool
+	Fallback            bool
+	Aggregate           bool
+	Submit              bool
+	DryRun              bool
+
+	// nodeNameErr is the reason the NodeName of the agent could not be determined.
+	nodeNameErr error
+	// discoveredClientCert is set when CertFile and KeyFile are the ones of the agent, not configured.
+	discoveredClientCert bool
 }
 
 var (
@@ -33,29 +67,75 @@ var (
 
 	// ErrNoCommand is returned when no PowerShell command could be parsed from flags.
 	ErrNoCommand = errors.New("no command found for PowerShell execution")
+
+	// ErrNoEndpoint is returned when no API endpoint is configured.
+	ErrNoEndpoint = errors.New("no API endpoint configured")
+
+	// ErrIncompleteClientCert is returned when only one of certificate and key file is configured.
+	ErrIncompleteClientCert = errors.New("client certificate requires both a certificate and a key file")
 )
 
 func NewConfig() *Config {
 	return &Config{
-		API:      DefaultAPI,
-		CertName: GetIcingaNodeName(),
-		CAFile:   IcingaCAPath,
+		API:    DefaultAPI,
+		CAFile: IcingaCAPath,
+		Icinga: DefaultIcingaPaths(),
+
+		StateFile:       DefaultStateFile,
+		FallbackCommand: DefaultFallbackCommand,
+		FrameworkConfig: IcingaFrameworkConfig,
+
+		Output:      OutputPlugin,
+		BatchFormat: BatchFormatJSON,
+		Workers:     4,
+
+		SubmitAPI: DefaultSubmitAPI,
 	}
 }
 
 // BuildFlags for a passed flag.FlagSet to store values inside Config.
 func (c *Config) BuildFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config", c.ConfigFile, "Config file to load, default: "+ConfigFileName+" next to the binary")
 	fs.StringVar(&c.Command, "command", c.Command, "Command to be executed")
-	fs.StringVar(&c.API, "api", c.API, "API Endpoint")
+	fs.StringVar(&c.API, "api", c.API, "API Endpoint, or a comma separated list of endpoints tried in order")
+	fs.StringVar(&c.FrameworkConfig, "framework-config", c.FrameworkConfig,
+		"Icinga for Windows configuration to discover the API from, when --api is not set")
+	fs.StringVar(&c.StateFile, "state-file", c.StateFile, "File to remember the last healthy API endpoint in")
+	fs.StringVar(&c.Icinga.VarsFile, "icinga-vars", c.Icinga.VarsFile, "icinga2.vars of the agent to read NodeName from")
+	fs.StringVar(&c.Icinga.ConstantsFile, "icinga-constants", c.Icinga.ConstantsFile, "constants.conf to read NodeName from, when icinga2.vars does not exist")
+	fs.StringVar(&c.Icinga.ZonesFile, "icinga-zones", c.Icinga.ZonesFile, "zones.conf to find the local Endpoint in, when NodeName is not a constant")
+	fs.StringVar(&c.Icinga.CertsDir, "icinga-certs", c.Icinga.CertsDir, "Directory with the certificate and key of the agent")
 	fs.StringVar(&c.CertName, "cert-name", c.CertName, "Certificate Name to be expected")
 	fs.StringVar(&c.CAFile, "ca-file", c.CAFile, "Icinga CA file to be loaded")
+	fs.StringVar(&c.CertFile, "cert-file", c.CertFile, "Client certificate file to authenticate with")
+	fs.StringVar(&c.KeyFile, "key-file", c.KeyFile, "Private key file of the client certificate")
+	fs.StringVar(&c.Socket, "socket", c.Socket, "Socket of the connector daemon (default "+DefaultSocket+")")
+	fs.StringSliceVar(&c.AllowCommands, "allow-command", c.AllowCommands, "Glob patterns of commands allowed to be executed, e.g. Invoke-IcingaCheck*")
+	fs.StringSliceVar(&c.DenyCommands, "deny-command", c.DenyCommands, "Glob patterns of commands never to be executed")
 	fs.BoolVar(&c.Insecure, "insecure", c.Insecure, "Ignore any certificate checks")
+	fs.BoolVar(&c.Fallback, "fallback", c.Fallback, "Execute the fallback command, when the API is not reachable")
+	fs.StringVar(&c.FallbackCommand, "fallback-command", c.FallbackCommand, "Command line to execute as fallback")
+	fs.BoolVar(&c.Aggregate, "aggregate", c.Aggregate, "Combine all check results of the API response into one output")
+	fs.StringVar(&c.Output, "output", c.Output, "Output format: "+strings.Join(OutputFormats, ", "))
+	fs.StringVar(&c.BatchFormat, "batch-format", c.BatchFormat, "Format of batch requests and results: json or netstring")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "Number of checks executed concurrently in batch mode")
+	fs.BoolVar(&c.Submit, "submit", c.Submit, "Submit the check result passively to the Icinga 2 API")
+	fs.StringVar(&c.SubmitAPI, "submit-api", c.SubmitAPI, "Icinga 2 API to submit the check result to")
+	fs.StringVar(&c.SubmitHost, "submit-host", c.SubmitHost, "Host to submit the check result for")
+	fs.StringVar(&c.SubmitService, "submit-service", c.SubmitService, "Service to submit the check result for, empty for a host check")
+	fs.StringVar(&c.SubmitCertName, "submit-cert-name", c.SubmitCertName, "Certificate Name of the Icinga 2 API, default: host of --submit-api")
+	fs.StringVar(&c.CheckSource, "check-source", c.CheckSource, "Check source of the submitted check result")
+	fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Print the request that would be sent to the API, without sending it")
 	fs.BoolVar(&c.Debug, "debug", c.Debug, "Enable debug logging")
 	fs.BoolVar(&c.PrintVersion, "version", false, "Print program version")
 	fs.Uint32Var(&c.Timeout, "timeout", 10, "Powershell connector timeout in seconds")
+	fs.UintVar(&c.Retries, "retries", 3, "Retries on connection failures and 502/503/504 from the API")
+	fs.DurationVar(&c.RetryDelay, "retry-delay", 500*time.Millisecond, "Delay before the first retry, doubled for every retry")
 }
 
 // ParseConfigFromFlags to be called to parse CLI arguments and return the built Config struct.
+//
+// Once the output format is known, Config is also returned with an error, so the error can be reported in that format.
 func ParseConfigFromFlags(arguments []string) (config *Config, err error) {
 	config = NewConfig()
 
@@ -77,6 +157,27 @@ func ParseConfigFromFlags(arguments []string) (config *Config, err error) {
 		return nil, ErrVersionRequested
 	}
 
+	err = applyEnvironmentAndConfigFile(fs, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !IsOutputFormat(config.Output) {
+		return nil, fmt.Errorf("unknown output format: %s", config.Output)
+	}
+
+	applyNodeName(fs, config)
+
+	err = discoverFrameworkRESTAPI(fs, config)
+	if err != nil {
+		return config, err
+	}
+
+	err = config.CommandPolicy().Validate()
+	if err != nil {
+		return config, err
+	}
+
 	// Parse Powershell arguments
 	command, args := GetPowershellArgs(powerShellArgs)
 	if command != "" {
@@ -84,14 +185,77 @@ func ParseConfigFromFlags(arguments []string) (config *Config, err error) {
 	}
 
 	config.Arguments = args
+	config.PowerShellArguments = powerShellArgs
 
 	if config.Command == "" {
 		return config, ErrNoCommand
 	}
 
+	// Reject the command before any request is made
+	err = config.CommandPolicy().Check(config.Command)
+	if err != nil {
+		return config, err
+	}
+
 	return
 }
 
+// applyNodeName sets the settings derived from the NodeName of the agent, unless configured otherwise.
+func applyNodeName(fs *flag.FlagSet, config *Config) {
+	name, err := config.Icinga.NodeName()
+	config.nodeNameErr = err
+
+	if name == "" {
+		return
+	}
+
+	certFile, keyFile := config.Icinga.NodeCertificate(name)
+
+	// Not set on the flags, so they stay defaults, e.g. for discoverFrameworkRESTAPI
+	if !fs.Changed("cert-name") {
+		config.CertName = name
+	}
+
+	// Only as a pair, never mixed with a configured certificate or key
+	if !fs.Changed("cert-file") && !fs.Changed("key-file") && certFile != "" {
+		config.CertFile = certFile
+		config.KeyFile = keyFile
+		config.discoveredClientCert = true
+	}
+
+	if !fs.Changed("submit-host") {
+		config.SubmitHost = name
+	}
+
+	if !fs.Changed("check-source") {
+		config.CheckSource = name
+	}
+}
+
+// applyEnvironmentAndConfigFile sets all flags not given on the command line.
+//
+// The precedence is: defaults < config file < environment (ICINGA_PSC_*) < command line flags.
+func applyEnvironmentAndConfigFile(fs *flag.FlagSet, config *Config) error {
+	fromCommandLine := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { fromCommandLine[f.Name] = true })
+
+	env := EnvironmentValues(fs)
+
+	// The config file itself might be set via environment
+	if path, ok := env["config"]; ok && !fromCommandLine["config"] {
+		config.ConfigFile = path
+	}
+
+	delete(env, "config")
+
+	err := loadConfigFile(fs, config.ConfigFile, fromCommandLine)
+	if err != nil {
+		return err
+	}
+
+	return applyConfigValues(fs, env, fromCommandLine, "environment")
+}
+
 // SplitPowerShellArguments separate this commands flags from Powershell.exe arguments.
 //
 // Usually this starts shorthand flag.
@@ -100,7 +264,7 @@ func SplitPowerShellArguments(arguments []string) (flags, powerShell []string) {
 
 	for _, arg := range arguments {
 		// Look for a shorthand argument
-		if arg[0] == '-' && arg[1] != '-' {
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' {
 			isPowerShell = true
 		}
 
@@ -114,14 +278,136 @@ func SplitPowerShellArguments(arguments []string) (flags, powerShell []string) {
 	return
 }
 
-func (c Config) NewClient() *http.Client {
+// APIEndpoints returns the list of endpoints configured in API.
+func (c Config) APIEndpoints() (endpoints []string) {
+	for _, endpoint := range strings.Split(c.API, ",") {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint != "" {
+			endpoints = append(endpoints, strings.TrimSuffix(endpoint, "/"))
+		}
+	}
+
+	return
+}
+
+// NewRestAPI builds a RestAPI with all endpoints and the HTTP client of Config.
+func (c Config) NewRestAPI(logger *slog.Logger) (*RestAPI, error) {
+	endpoints := c.APIEndpoints()
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	// Without a name the certificate of the API can not be verified
+	if c.CertName == "" && !c.Insecure {
+		err := c.nodeNameErr
+		if err == nil {
+			err = ErrNoNodeName
+		}
+
+		return nil, fmt.Errorf("%w, set --cert-name", err)
+	}
+
+	client, err := c.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestAPI{
+		URL:        endpoints[0],
+		Failover:   endpoints[1:],
+		StateFile:  c.StateFile,
+		Client:     client,
+		Logger:     logger,
+		Retries:    c.Retries,
+		RetryDelay: c.RetryDelay,
+		Aggregate:  c.Aggregate,
+	}, nil
+}
+
+// DaemonSettings returns the settings of the connection to the REST API, to be checked by the daemon.
+func (c Config) DaemonSettings() DaemonSettings {
+	return DaemonSettings{
+		API:        c.APIEndpoints(),
+		CertName:   c.CertName,
+		CAFile:     c.CAFile,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+		StateFile:  c.StateFile,
+		Retries:    c.Retries,
+		RetryDelay: c.RetryDelay,
+		Insecure:   c.Insecure,
+		Aggregate:  c.Aggregate,
+	}
+}
+
+// NewClient builds a HTTP client with the TLS settings of Config.
+//
+// A client certificate is only presented, when both CertFile and KeyFile are set.
+// The certificate of the agent is skipped when it can not be read, e.g. without permissions,
+// only a configured one is required to load.
+func (c Config) NewClient() (*http.Client, error) {
 	tlsConfig := &tls.Config{
 		RootCAs:            LoadIcingaCACert(c.CAFile),
 		InsecureSkipVerify: c.Insecure, // nolint:gosec // intended configuration
 		ServerName:         c.CertName,
 	}
 
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, ErrIncompleteClientCert
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+
+		switch {
+		case err == nil:
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		case c.discoveredClientCert:
+			slog.Debug("could not load certificate of the agent, continuing without client certificate",
+				"cert", c.CertFile, "error", err)
+		default:
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+	}
+
 	transport := &http.Transport{TLSClientConfig: tlsConfig}
 
-	return &http.Client{Transport: transport}
+	return &http.Client{Transport: transport}, nil
+}
+
+// CommandPolicy returns the allowed and denied commands.
+func (c Config) CommandPolicy() CommandPolicy {
+	return CommandPolicy{Allow: c.AllowCommands, Deny: c.DenyCommands}
+}
+
+// NewResultWriter builds a ResultWriter for the configured output format.
+func (c Config) NewResultWriter() ResultWriter {
+	return ResultWriter{
+		Format: c.Output,
+		Submitter: Submitter{
+			Host:        c.SubmitHost,
+			Service:     c.SubmitService,
+			CheckSource: c.CheckSource,
+		},
+	}
+}
+
+// NewSubmitter builds a Submitter for the Icinga 2 API, with the TLS settings of Config.
+func (c Config) NewSubmitter(logger *slog.Logger) (*Submitter, error) {
+	// The Icinga 2 API presents its own certificate, not the one of the local node
+	c.CertName = c.SubmitCertName
+
+	client, err := c.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Submitter{
+		URL:         c.SubmitAPI,
+		Host:        c.SubmitHost,
+		Service:     c.SubmitService,
+		CheckSource: c.CheckSource,
+		Client:      client,
+		Logger:      logger,
+	}, nil
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+const (
+	// EnvironmentPrefix for variables overriding settings, e.g. ICINGA_PSC_API for --api.
+	EnvironmentPrefix = "ICINGA_PSC_"
+)
+
+// EnvironmentVariable returns the name of the variable for a flag, e.g. ICINGA_PSC_CERT_NAME for --cert-name.
+func EnvironmentVariable(flagName string) string {
+	return EnvironmentPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// EnvironmentValues returns the values of all flags, which are set as environment variable.
+func EnvironmentValues(fs *flag.FlagSet) map[string]string {
+	values := map[string]string{}
+
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "version" {
+			return
+		}
+
+		if value, ok := os.LookupEnv(EnvironmentVariable(f.Name)); ok {
+			values[f.Name] = value
+		}
+	})
+
+	return values
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigFileName is looked up next to the binary and in IcingaDataPath, when no --config is given.
+	ConfigFileName = "connector.yml"
+)
+
+// DefaultConfigFiles returns the paths searched for a config file, in order.
+func DefaultConfigFiles() (paths []string) {
+	if executable, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(executable), ConfigFileName))
+	}
+
+	return append(paths, IcingaDataPath+"/"+ConfigFileName)
+}
+
+// LoadConfigFile reads a YAML file, using the names of our flags as keys.
+//
+// Example:
+//
+//	api: https://localhost:5668
+//	timeout: 30
+//	insecure: true
+func LoadConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+
+	for key, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("invalid value for %s in config file %s: only scalar values are supported", key, path)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+
+	return values, nil
+}
+
+// findConfigFile returns the first existing default config file, or an empty string.
+func findConfigFile() string {
+	for _, path := range DefaultConfigFiles() {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return ""
+}
+
+// applyConfigValues sets every value on its flag, unless the flag has been set on the command line.
+func applyConfigValues(fs *flag.FlagSet, values map[string]string, fromCommandLine map[string]bool, source string) error {
+	for name, value := range values {
+		if name == "config" || name == "version" {
+			return fmt.Errorf("%s can not be set in %s", name, source)
+		}
+
+		if fromCommandLine[name] {
+			continue
+		}
+
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("unknown setting %s in %s", name, source)
+		}
+
+		// Lists are replaced, so a later source overrides instead of extending them
+		if slice, ok := f.Value.(flag.SliceValue); ok && f.Changed {
+			_ = slice.Replace(nil)
+		}
+
+		err := fs.Set(name, value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in %s: %w", name, source, err)
+		}
+	}
+
+	return nil
+}
+
+// loadConfigFile applies the config file to all flags not set on the command line.
+//
+// A missing default config file is fine, a missing file passed via --config is an error.
+func loadConfigFile(fs *flag.FlagSet, path string, fromCommandLine map[string]bool) error {
+	if path == "" {
+		path = findConfigFile()
+		if path == "" {
+			return nil
+		}
+	}
+
+	values, err := LoadConfigFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("config file %s does not exist: %w", path, err)
+		}
+
+		return err
+	}
+
+	return applyConfigValues(fs, values, fromCommandLine, "config file "+path)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	values, err := LoadConfigFile("testdata/connector.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"api":              "https://localhost:5669",
+		"timeout":          "30",
+		"insecure":         "true",
+		"retry-delay":      "1s",
+		"fallback-command": "pwsh -NoProfile",
+	}, values)
+
+	_, err = LoadConfigFile(writeTestConfigFile(t, "api: [a, b]"))
+	assert.ErrorContains(t, err, "only scalar values are supported")
+
+	_, err = LoadConfigFile(writeTestConfigFile(t, "api: : :"))
+	assert.ErrorContains(t, err, "could not parse config file")
+
+	_, err = LoadConfigFile("testdata/missing.yml")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseConfigFromFlagsConfigFile(t *testing.T) {
+	config, err := ParseConfigFromFlags([]string{
+		"--config", "testdata/connector.yml", "--timeout", "5", "-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:5669", config.API)
+	assert.Equal(t, uint32(5), config.Timeout)
+	assert.True(t, config.Insecure)
+	assert.Equal(t, time.Second, config.RetryDelay)
+	assert.Equal(t, "pwsh -NoProfile", config.FallbackCommand)
+
+	// Flags win, even when set to their default
+	config, err = ParseConfigFromFlags([]string{
+		"--config", "testdata/connector.yml", "--insecure=false", "--api", DefaultAPI, "-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAPI, config.API)
+	assert.False(t, config.Insecure)
+	assert.Equal(t, uint32(30), config.Timeout)
+
+	// Broken config files
+	_, err = ParseConfigFromFlags([]string{"--config", "testdata/missing.yml", "-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "does not exist")
+
+	_, err = ParseConfigFromFlags([]string{"--config", writeTestConfigFile(t, "unknown: 1"), "-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "unknown setting unknown")
+
+	_, err = ParseConfigFromFlags([]string{"--config", writeTestConfigFile(t, "timeout: abc"), "-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "invalid value for timeout")
+
+	_, err = ParseConfigFromFlags([]string{"--config", writeTestConfigFile(t, "version: true"), "-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "version can not be set")
+}
@@ -1,8 +1,21 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	flag "github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
@@ -90,3 +103,279 @@ func TestSplitPowerShellArguments(t *testing.T) {
 		"-C", "try { Use-Icinga -Minimal; ... -Command 'Invoke-IcingaCheckUsedPartitionSpace' ", "-argWithH"},
 		powerShellArgs)
 }
+
+// writeTestCertificate creates a certificate signed by parent, or a self-signed CA without parent.
+func writeTestCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (
+	cert *x509.Certificate, key *ecdsa.PrivateKey, certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _ = x509.ParseCertificate(der)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	return
+}
+
+func TestConfigNewClientCertificate(t *testing.T) {
+	ca, caKey, _, _ := writeTestCertificate(t, "Icinga CA", nil, nil)
+	_, _, certFile, keyFile := writeTestCertificate(t, "agent.example.com", ca, caKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCA := filepath.Join(t.TempDir(), "ca.crt")
+	_ = os.WriteFile(serverCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+
+	config := &Config{CAFile: serverCA, CertName: "example.com", CertFile: certFile, KeyFile: keyFile}
+
+	client, err := config.NewClient()
+	assert.NoError(t, err)
+
+	resp, err := client.Get(srv.URL)
+	if assert.NoError(t, err) {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Without a certificate the server refuses the connection
+	config.CertFile, config.KeyFile = "", ""
+
+	client, err = config.NewClient()
+	assert.NoError(t, err)
+
+	_, err = client.Get(srv.URL)
+	assert.Error(t, err)
+
+	// Broken configurations
+	config.CertFile = certFile
+
+	_, err = config.NewClient()
+	assert.ErrorIs(t, err, ErrIncompleteClientCert)
+
+	config.KeyFile = filepath.Join(t.TempDir(), "missing.key")
+
+	_, err = config.NewClient()
+	assert.ErrorContains(t, err, "could not load client certificate")
+
+	// The certificate of the agent is optional
+	config.discoveredClientCert = true
+
+	_, err = config.NewClient()
+	assert.NoError(t, err)
+}
+
+func TestParseConfigFromFlagsCertificate(t *testing.T) {
+	config, err := ParseConfigFromFlags([]string{
+		"--cert-file", "agent.crt", "--key-file", "agent.key", "--command", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "agent.crt", config.CertFile)
+	assert.Equal(t, "agent.key", config.KeyFile)
+}
+
+func TestEnvironmentVariable(t *testing.T) {
+	assert.Equal(t, "ICINGA_PSC_API", EnvironmentVariable("api"))
+	assert.Equal(t, "ICINGA_PSC_CERT_NAME", EnvironmentVariable("cert-name"))
+	assert.Equal(t, "ICINGA_PSC_RETRY_DELAY", EnvironmentVariable("retry-delay"))
+}
+
+func TestParseConfigFromFlagsEnvironment(t *testing.T) {
+	t.Setenv("ICINGA_PSC_API", "https://env:5668")
+	t.Setenv("ICINGA_PSC_CERT_NAME", "env.example.com")
+	t.Setenv("ICINGA_PSC_CA_FILE", "env-ca.crt")
+	t.Setenv("ICINGA_PSC_TIMEOUT", "20")
+	t.Setenv("ICINGA_PSC_INSECURE", "1")
+	t.Setenv("ICINGA_PSC_DEBUG", "true")
+	t.Setenv("ICINGA_PSC_RETRY_DELAY", "2s")
+	t.Setenv("ICINGA_PSC_VERSION", "true")
+
+	// env > default
+	config, err := ParseConfigFromFlags([]string{"-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://env:5668", config.API)
+	assert.Equal(t, "env.example.com", config.CertName)
+	assert.Equal(t, "env-ca.crt", config.CAFile)
+	assert.Equal(t, uint32(20), config.Timeout)
+	assert.True(t, config.Insecure)
+	assert.True(t, config.Debug)
+	assert.Equal(t, 2*time.Second, config.RetryDelay)
+	assert.Equal(t, uint(3), config.Retries)
+
+	// flag > env
+	config, err = ParseConfigFromFlags([]string{
+		"--api", "https://flag:5668", "--timeout", "10", "--insecure=false", "-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://flag:5668", config.API)
+	assert.Equal(t, uint32(10), config.Timeout)
+	assert.False(t, config.Insecure)
+	assert.Equal(t, "env.example.com", config.CertName)
+
+	// env > config file, also selecting the file
+	t.Setenv("ICINGA_PSC_CONFIG", "testdata/connector.yml")
+
+	config, err = ParseConfigFromFlags([]string{"-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://env:5668", config.API)
+	assert.Equal(t, uint32(20), config.Timeout)
+	assert.Equal(t, "pwsh -NoProfile", config.FallbackCommand)
+
+	t.Setenv("ICINGA_PSC_TIMEOUT", "abc")
+
+	_, err = ParseConfigFromFlags([]string{"-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "invalid value for timeout in environment")
+}
+
+func TestConfigAPIEndpoints(t *testing.T) {
+	config := &Config{API: "https://localhost:5668", CertName: "agent.example.com"}
+	assert.Equal(t, []string{"https://localhost:5668"}, config.APIEndpoints())
+
+	config.API = "https://localhost:5668/, https://localhost:5669,,"
+	assert.Equal(t, []string{"https://localhost:5668", "https://localhost:5669"}, config.APIEndpoints())
+
+	api, err := config.NewRestAPI(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:5668", api.URL)
+	assert.Equal(t, []string{"https://localhost:5669"}, api.Failover)
+
+	config.API = ""
+
+	_, err = config.NewRestAPI(nil)
+	assert.ErrorIs(t, err, ErrNoEndpoint)
+}
+
+func TestConfigNewRestAPINodeName(t *testing.T) {
+	config := &Config{API: "https://localhost:5668", nodeNameErr: fmt.Errorf("%w: vars broken", ErrNoNodeName)}
+
+	_, err := config.NewRestAPI(nil)
+	assert.ErrorIs(t, err, ErrNoNodeName)
+	assert.EqualError(t, err, "could not determine NodeName of the Icinga agent: vars broken, set --cert-name")
+
+	config.nodeNameErr = nil
+
+	_, err = config.NewRestAPI(nil)
+	assert.ErrorIs(t, err, ErrNoNodeName)
+
+	// Not verifying the certificate does not need a name
+	config.Insecure = true
+
+	_, err = config.NewRestAPI(nil)
+	assert.NoError(t, err)
+}
+
+func TestParseConfigFromFlagsCommandPolicy(t *testing.T) {
+	config, err := ParseConfigFromFlags([]string{
+		"--allow-command", "Invoke-IcingaCheck*", "--deny-command", "Invoke-IcingaCheckScheduledTask",
+		"-C", "Invoke-IcingaCheckCPU"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Invoke-IcingaCheck*"}, config.AllowCommands)
+
+	// The config is returned, to report the error in the output format
+	config, err = ParseConfigFromFlags([]string{"--output", "json",
+		"--allow-command", "Invoke-IcingaCheck*", "-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Get-Process'"})
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+
+	if assert.NotNil(t, config) {
+		assert.Equal(t, OutputJSON, config.Output)
+	}
+
+	_, err = ParseConfigFromFlags([]string{"--deny-command", "[", "-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorContains(t, err, "invalid command pattern")
+
+	// env replaces the list of the config file
+	t.Setenv("ICINGA_PSC_CONFIG", writeTestConfigFile(t, "allow-command: Invoke-IcingaCheckCPU\n"))
+	t.Setenv("ICINGA_PSC_ALLOW_COMMAND", "Invoke-IcingaCheckMemory,Invoke-IcingaCheckUptime")
+
+	config, err = ParseConfigFromFlags([]string{"-C", "Invoke-IcingaCheckMemory"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Invoke-IcingaCheckMemory", "Invoke-IcingaCheckUptime"}, config.AllowCommands)
+
+	_, err = ParseConfigFromFlags([]string{"-C", "Invoke-IcingaCheckCPU"})
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+}
+
+func TestParseConfigFromFlagsIcingaPaths(t *testing.T) {
+	args := []string{
+		"--icinga-vars", filepath.Join(t.TempDir(), "missing.vars"),
+		"--icinga-constants", "testdata/icinga2/constants.conf",
+		"--icinga-zones", "testdata/icinga2/zones.conf",
+		"--framework-config", "",
+		"-C", "Invoke-IcingaCheckCPU",
+	}
+
+	config, err := ParseConfigFromFlags(args)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent.example.com", config.CertName)
+	assert.Equal(t, "agent.example.com", config.SubmitHost)
+	assert.Equal(t, "agent.example.com", config.CheckSource)
+	assert.NoError(t, config.nodeNameErr)
+
+	// The certificate of the agent is used, but not required to be readable
+	certs := t.TempDir()
+	for _, name := range []string{"agent.example.com.crt", "agent.example.com.key"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(certs, name), []byte("unreadable"), 0600))
+	}
+
+	config, err = ParseConfigFromFlags(append([]string{"--icinga-certs", certs}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(certs, "agent.example.com.crt"), config.CertFile)
+	assert.True(t, config.discoveredClientCert)
+
+	_, err = config.NewClient()
+	assert.NoError(t, err)
+
+	// A single configured file is never mixed with the agent's
+	config, err = ParseConfigFromFlags(append([]string{"--icinga-certs", certs, "--cert-file", "other.crt"}, args...))
+	assert.NoError(t, err)
+	assert.Empty(t, config.KeyFile)
+
+	_, err = config.NewClient()
+	assert.ErrorIs(t, err, ErrIncompleteClientCert)
+
+	// Flags win over the NodeName
+	config, err = ParseConfigFromFlags(append([]string{"--cert-name", "other.example.com", "--check-source", "satellite"}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "other.example.com", config.CertName)
+	assert.Equal(t, "agent.example.com", config.SubmitHost)
+	assert.Equal(t, "satellite", config.CheckSource)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	daemonCheckPath = "/v1/check"
+
+	// Classes of errors in DaemonResponse, so the client can handle them like errors of its own.
+	DaemonErrorConnection = "connection"
+	DaemonErrorStatus     = "status"
+	DaemonErrorSettings   = "settings"
+	DaemonErrorNotAllowed = "not_allowed"
+)
+
+var (
+	// ErrDaemonUnavailable is returned when no daemon is listening on the socket.
+	ErrDaemonUnavailable = errors.New("connector daemon is not available")
+
+	// ErrDaemonRunning is returned when another daemon is already listening on the socket.
+	ErrDaemonRunning = errors.New("connector daemon is already running")
+
+	// ErrDaemonSettings is returned when the daemon connects to the API with other settings than the client.
+	ErrDaemonSettings = errors.New("connector daemon uses other connection settings")
+)
+
+// CheckExecutor executes a check and returns its result, e.g. directly via RestAPI or through a daemon.
+type CheckExecutor interface {
+	ExecuteCheck(command string, arguments map[string]interface{}, timeout uint32) (*APICheckResult, error)
+}
+
+// DaemonRequest is sent from the CLI to the daemon.
+type DaemonRequest struct {
+	Command   string                 `json:"command"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Timeout   uint32                 `json:"timeout"`
+	Settings  *DaemonSettings        `json:"settings,omitempty"`
+}
+
+// DaemonSettings are the settings of the connection to the REST API, which must be the same for client and daemon.
+type DaemonSettings struct {
+	API        []string      `json:"api"`
+	CertName   string        `json:"cert_name"`
+	CAFile     string        `json:"ca_file"`
+	CertFile   string        `json:"cert_file"`
+	KeyFile    string        `json:"key_file"`
+	StateFile  string        `json:"state_file"`
+	Retries    uint          `json:"retries"`
+	RetryDelay time.Duration `json:"retry_delay"`
+	Insecure   bool          `json:"insecure"`
+	Aggregate  bool          `json:"aggregate"`
+}
+
+// DaemonResponse is returned by the daemon, either with a result or an error message.
+type DaemonResponse struct {
+	Result *APICheckResult `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	// ErrorClass is one of the DaemonError* constants, empty for any other error.
+	ErrorClass string `json:"error_class,omitempty"`
+	// StatusCode of the API, for DaemonErrorStatus.
+	StatusCode int `json:"status_code,omitempty"`
+}
+
+// DaemonError is an error of the daemon, rebuilt by the client from DaemonResponse.
+type DaemonError struct {
+	Class      string
+	StatusCode int
+	Message    string
+}
+
+func (e *DaemonError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error of the class, so errors.Is and errors.As work like without the daemon.
+func (e *DaemonError) Unwrap() error {
+	switch e.Class {
+	case DaemonErrorStatus:
+		return &APIStatusError{StatusCode: e.StatusCode}
+	case DaemonErrorSettings:
+		return ErrDaemonSettings
+	case DaemonErrorNotAllowed:
+		return ErrCommandNotAllowed
+	}
+
+	return nil
+}
+
+// setError sets the message and class of err on the response.
+func (r *DaemonResponse) setError(err error) {
+	var statusErr *APIStatusError
+
+	r.Error = err.Error()
+
+	switch {
+	case IsConnectionError(err):
+		r.ErrorClass = DaemonErrorConnection
+	case errors.As(err, &statusErr):
+		r.ErrorClass = DaemonErrorStatus
+		r.StatusCode = statusErr.StatusCode
+	case errors.Is(err, ErrDaemonSettings):
+		r.ErrorClass = DaemonErrorSettings
+	case errors.Is(err, ErrCommandNotAllowed):
+		r.ErrorClass = DaemonErrorNotAllowed
+	}
+}
+
+// Daemon keeps a pooled HTTP client to the REST API and serves check requests on a local socket.
+type Daemon struct {
+	API CheckExecutor
+	// Settings the API is connected with, requests with other settings are rejected. Nil accepts any request.
+	Settings *DaemonSettings
+	Logger   *slog.Logger
+}
+
+// NewDaemon builds a Daemon with a keep-alive client to the REST API, based on Config.
+func NewDaemon(config *Config, logger *slog.Logger) (*Daemon, error) {
+	api, err := config.NewRestAPI(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if transport, ok := api.Client.Transport.(*http.Transport); ok {
+		transport.MaxIdleConnsPerHost = 16
+		transport.IdleConnTimeout = 5 * time.Minute
+	}
+
+	settings := config.DaemonSettings()
+
+	return &Daemon{API: config.CommandPolicy().Executor(api), Settings: &settings, Logger: logger}, nil
+}
+
+// Mismatches returns the names of the settings differing from other.
+func (s DaemonSettings) Mismatches(other DaemonSettings) (names []string) {
+	for _, setting := range []struct {
+		name  string
+		equal bool
+	}{
+		{"api", slices.Equal(s.API, other.API)},
+		{"cert-name", s.CertName == other.CertName},
+		{"ca-file", s.CAFile == other.CAFile},
+		{"cert-file", s.CertFile == other.CertFile},
+		{"key-file", s.KeyFile == other.KeyFile},
+		{"state-file", s.StateFile == other.StateFile},
+		{"retries", s.Retries == other.Retries},
+		{"retry-delay", s.RetryDelay == other.RetryDelay},
+		{"insecure", s.Insecure == other.Insecure},
+		{"aggregate", s.Aggregate == other.Aggregate},
+	} {
+		if !setting.equal {
+			names = append(names, setting.name)
+		}
+	}
+
+	return
+}
+
+// ListenAndServe listens on the socket until the context is done.
+//
+// A stale socket file of a previous daemon is removed before listening. The socket is a Unix socket on all platforms,
+// see DefaultSocket.
+func (d *Daemon) ListenAndServe(ctx context.Context, socket string) error {
+	err := removeStaleSocket(socket)
+	if err != nil {
+		return err
+	}
+
+	listener, err := listenDaemon(socket)
+	if err != nil {
+		return fmt.Errorf("could not listen on socket: %w", err)
+	}
+
+	defer os.Remove(socket)
+
+	return d.Serve(ctx, listener)
+}
+
+// removeStaleSocket removes the socket of a daemon which did not shut down cleanly.
+//
+// Nothing else is removed, neither other files nor the socket of a daemon still listening.
+func removeStaleSocket(socket string) error {
+	info, err := os.Lstat(socket)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not check socket: %w", err)
+	}
+
+	if !isSocketFile(info) {
+		return fmt.Errorf("could not listen on socket: %s exists and is not a socket", socket)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	conn, err := dialDaemon(ctx, socket)
+	if err == nil {
+		_ = conn.Close()
+
+		return fmt.Errorf("%w on %s", ErrDaemonRunning, socket)
+	}
+
+	err = os.Remove(socket)
+	if err != nil {
+		return fmt.Errorf("could not remove stale socket: %w", err)
+	}
+
+	return nil
+}
+
+// Serve check requests on listener until the context is done.
+func (d *Daemon) Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(daemonCheckPath, d.handleCheck)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	d.Logger.Info("daemon listening", "address", listener.Addr().String())
+
+	err := server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (d *Daemon) handleCheck(w http.ResponseWriter, r *http.Request) {
+	var (
+		request  DaemonRequest
+		response DaemonResponse
+	)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		response.Error = fmt.Sprintf("could not parse request: %s", err)
+	} else if err = d.checkSettings(request.Settings); err != nil {
+		response.setError(err)
+	} else {
+		d.Logger.Debug("executing check for client", "command", request.Command)
+
+		response.Result, err = d.API.ExecuteCheck(request.Command, request.Arguments, request.Timeout)
+		if err != nil {
+			response.setError(err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// checkSettings makes sure a check never reaches another API, or with other trust settings, than the client expects.
+func (d *Daemon) checkSettings(settings *DaemonSettings) error {
+	if d.Settings == nil {
+		return nil
+	}
+
+	if settings == nil {
+		return fmt.Errorf("%w: none sent by client", ErrDaemonSettings)
+	}
+
+	if names := d.Settings.Mismatches(*settings); len(names) > 0 {
+		return fmt.Errorf("%w: %s", ErrDaemonSettings, strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// DaemonClient forwards checks to a running Daemon.
+type DaemonClient struct {
+	Socket string
+	// Settings the daemon must use to connect to the API.
+	Settings *DaemonSettings
+	Logger   *slog.Logger
+}
+
+func (c DaemonClient) ExecuteCheck(command string, arguments map[string]interface{}, timeout uint32) (*APICheckResult, error) { //nolint:lll
+	body, err := json.Marshal(DaemonRequest{Command: command, Arguments: arguments, Timeout: timeout, Settings: c.Settings})
+	if err != nil {
+		return nil, fmt.Errorf("could not build daemon request: %w", err)
+	}
+
+	// Give the daemon a bit more time than the API request itself
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second+time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://daemon"+daemonCheckPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not build daemon request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	c.Logger.Debug("forwarding check to daemon", "socket", c.Socket)
+
+	resp, err := c.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon request failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read daemon response: %w", err)
+	}
+
+	var response DaemonResponse
+
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse daemon response: %w", err)
+	}
+
+	if response.Error != "" {
+		return nil, &DaemonError{Class: response.ErrorClass, StatusCode: response.StatusCode, Message: response.Error}
+	}
+
+	if response.Result == nil {
+		return nil, fmt.Errorf("no check result in daemon response")
+	}
+
+	return response.Result, nil
+}
+
+func (c DaemonClient) client() *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, err := dialDaemon(ctx, c.Socket)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrDaemonUnavailable, err)
+			}
+
+			return conn, nil
+		},
+	}
+
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startTestDaemon(t *testing.T, api CheckExecutor) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "connector.sock")
+	daemon := &Daemon{API: api, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- daemon.ListenAndServe(ctx, socket)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-done)
+	})
+
+	waitForSocket(socket)
+
+	return socket
+}
+
+// waitForSocket until the daemon is listening.
+func waitForSocket(socket string) {
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonExecuteCheck(t *testing.T) {
+	var requests, connections atomic.Int32
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckCPU": {"exitcode": 1, "checkresult": "[WARNING] CPU", "perfdata": ["'load'=90%;80;95"]}}`))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	socket := startTestDaemon(t, RestAPI{URL: srv.URL, Client: srv.Client(), Logger: logger})
+
+	client := DaemonClient{Socket: socket, Logger: logger}
+
+	for i := 0; i < 3; i++ {
+		result, err := client.ExecuteCheck("Invoke-IcingaCheckCPU", map[string]interface{}{"-Warning": int64(80)}, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, &APICheckResult{
+			ExitCode:    1,
+			CheckResult: "[WARNING] CPU",
+			Perfdata:    APIPerfdataList{"'load'=90%;80;95"},
+		}, result)
+	}
+
+	assert.Equal(t, int32(3), requests.Load())
+	// All checks share a single TLS connection to the API
+	assert.Equal(t, int32(1), connections.Load())
+}
+
+func TestDaemonExecuteCheckError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`broken`))
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	socket := startTestDaemon(t, RestAPI{URL: srv.URL, Logger: logger})
+
+	_, err := DaemonClient{Socket: socket, Logger: logger}.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.ErrorContains(t, err, "API request not successful code=500: broken")
+	assert.NotErrorIs(t, err, ErrDaemonUnavailable)
+	assert.False(t, IsConnectionError(err))
+
+	var statusErr *APIStatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, http.StatusInternalServerError, statusErr.StatusCode)
+	}
+
+	// The class of the error is kept, e.g. to run the fallback
+	srv.Close()
+
+	socket = startTestDaemon(t, RestAPI{URL: srv.URL, Logger: logger})
+
+	_, err = DaemonClient{Socket: socket, Logger: logger}.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.True(t, IsConnectionError(err), err)
+
+	socket = startTestDaemon(t, CommandPolicy{Deny: []string{"*"}}.Executor(RestAPI{URL: srv.URL, Logger: logger}))
+
+	_, err = DaemonClient{Socket: socket, Logger: logger}.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+	assert.False(t, IsConnectionError(err))
+}
+
+func TestDaemonSettings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckCPU": {"exitcode": 0, "checkresult": "[OK] CPU", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := &Config{API: srv.URL, CertName: "agent.example.com", Retries: 3}
+	settings := config.DaemonSettings()
+
+	socket := filepath.Join(t.TempDir(), "connector.sock")
+	daemon := &Daemon{API: RestAPI{URL: srv.URL, Logger: logger}, Settings: &settings, Logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- daemon.ListenAndServe(ctx, socket)
+	}()
+
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	waitForSocket(socket)
+
+	client := DaemonClient{Socket: socket, Settings: &settings, Logger: logger}
+
+	result, err := client.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "[OK] CPU", result.CheckResult)
+
+	// The client wants another endpoint and to skip verification
+	config.API = "https://other:5668"
+	config.Insecure = true
+	other := config.DaemonSettings()
+	client.Settings = &other
+
+	_, err = client.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.ErrorContains(t, err, "connector daemon uses other connection settings: api, insecure")
+
+	client.Settings = nil
+
+	_, err = client.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.ErrorContains(t, err, "connector daemon uses other connection settings: none sent by client")
+}
+
+func TestDaemonUnavailable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	client := DaemonClient{Socket: filepath.Join(t.TempDir(), "missing.sock"), Logger: logger}
+
+	_, err := client.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 10)
+	assert.ErrorIs(t, err, ErrDaemonUnavailable)
+}
+
+func TestExecuteCheckFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckCPU": {"exitcode": 0, "checkresult": "[OK] CPU", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	config := &Config{
+		Command: "Invoke-IcingaCheckCPU",
+		Timeout: 10,
+		Socket:  filepath.Join(t.TempDir(), "missing.sock"),
+	}
+
+	result, err := executeCheck(config, RestAPI{URL: srv.URL, Logger: logger}, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "[OK] CPU", result.CheckResult)
+}
+
+func TestExecuteCheckDaemonSettings(t *testing.T) {
+	var requests atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckCPU": {"exitcode": 0, "checkresult": "[OK] CPU", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	daemonSettings := (&Config{API: "https://other:5668"}).DaemonSettings()
+
+	socket := filepath.Join(t.TempDir(), "connector.sock")
+	daemon := &Daemon{API: RestAPI{URL: "https://other:5668", Logger: logger}, Settings: &daemonSettings, Logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- daemon.ListenAndServe(ctx, socket)
+	}()
+
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	waitForSocket(socket)
+
+	config := &Config{API: srv.URL, Command: "Invoke-IcingaCheckCPU", Timeout: 10}
+
+	// The daemon on the default socket is skipped
+	result, err := executeCheckVia(config, socket, RestAPI{URL: srv.URL, Logger: logger}, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, "[OK] CPU", result.CheckResult)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// The daemon configured with --socket must match
+	config.Socket = socket
+
+	_, err = executeCheckVia(config, socket, RestAPI{URL: srv.URL, Logger: logger}, logger)
+	assert.ErrorIs(t, err, ErrDaemonSettings)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestDaemonListenSocket(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	daemon := &Daemon{API: RestAPI{URL: "https://localhost:5668", Logger: logger}, Logger: logger}
+
+	// Other files are never removed
+	path := filepath.Join(t.TempDir(), "connector.sock")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0600))
+
+	err := daemon.ListenAndServe(context.Background(), path)
+	assert.ErrorContains(t, err, "exists and is not a socket")
+	assert.FileExists(t, path)
+
+	// The socket of a running daemon is kept
+	socket := startTestDaemon(t, daemon.API)
+
+	err = daemon.ListenAndServe(context.Background(), socket)
+	assert.ErrorIs(t, err, ErrDaemonRunning)
+
+	_, err = DaemonClient{Socket: socket, Logger: logger}.ExecuteCheck("Invoke-IcingaCheckCPU", nil, 1)
+	assert.NotErrorIs(t, err, ErrDaemonUnavailable)
+
+	// A stale socket is replaced
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+
+	listener, err := net.Listen("unix", stale)
+	assert.NoError(t, err)
+
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	assert.NoError(t, listener.Close())
+	assert.FileExists(t, stale)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, daemon.ListenAndServe(ctx, stale))
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+)
+
+// DefaultSocket where the connector daemon is listening, when --socket is not set.
+const DefaultSocket = IcingaStatePrefix + "/run/icinga2/powershell-connector.sock"
+
+// listenDaemon listens on the Unix socket.
+func listenDaemon(socket string) (net.Listener, error) {
+	return net.Listen("unix", socket)
+}
+
+// dialDaemon connects to the Unix socket of the daemon.
+func dialDaemon(ctx context.Context, socket string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	return dialer.DialContext(ctx, "unix", socket)
+}
+
+// isSocketFile reports whether info is a Unix socket.
+func isSocketFile(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSocket != 0
+}
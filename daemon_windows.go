@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// DefaultSocket where the connector daemon is listening, when --socket is not set, next to icinga2.pid of the agent.
+//
+// Windows provides Unix sockets since Windows 10 1803 and Windows Server 2019.
+const DefaultSocket = IcingaStatePrefix + "/run/icinga2/powershell-connector.sock"
+
+// wsaEAFNOSUPPORT is returned by Winsock, when Windows does not support Unix sockets.
+const wsaEAFNOSUPPORT = syscall.Errno(10047)
+
+// listenDaemon listens on the Unix socket.
+func listenDaemon(socket string) (net.Listener, error) {
+	listener, err := net.Listen("unix", filepath.FromSlash(socket))
+	if errors.Is(err, wsaEAFNOSUPPORT) {
+		return nil, fmt.Errorf("%w: Unix sockets require Windows 10 1803 or Windows Server 2019", err)
+	}
+
+	return listener, err
+}
+
+// dialDaemon connects to the Unix socket of the daemon.
+func dialDaemon(ctx context.Context, socket string) (net.Conn, error) {
+	var dialer net.Dialer
+
+	return dialer.DialContext(ctx, "unix", filepath.FromSlash(socket))
+}
+
+// isSocketFile reports whether info is a Unix socket.
+//
+// Before Go 1.23 the socket is not reported as os.ModeSocket, but only as reparse point, which is not a symlink.
+func isSocketFile(info os.FileInfo) bool {
+	if info.Mode()&os.ModeSocket != 0 {
+		return true
+	}
+
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0 && info.Mode()&os.ModeSymlink == 0
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DryRunRequest describes the request that would be sent to the API, see --dry-run.
+type DryRunRequest struct {
+	URL       string          `json:"url"`
+	Endpoints []string        `json:"endpoints"`
+	Command   string          `json:"command"`
+	Body      json.RawMessage `json:"body"`
+	TLS       DryRunTLS       `json:"tls"`
+}
+
+// DryRunTLS are the effective TLS settings of the request.
+type DryRunTLS struct {
+	CAFile     string `json:"ca_file"`
+	ServerName string `json:"server_name"`
+	Insecure   bool   `json:"insecure"`
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+}
+
+// DryRunRequest resolves the request for the configured command, without contacting the API.
+func (c Config) DryRunRequest() (*DryRunRequest, error) {
+	endpoints := c.APIEndpoints()
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoint
+	}
+
+	body, err := json.Marshal(c.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("could not build JSON body: %w", err)
+	}
+
+	api := RestAPI{URL: endpoints[0], Failover: endpoints[1:], StateFile: c.StateFile}
+	endpoints = api.Endpoints()
+
+	return &DryRunRequest{
+		URL:       checkerURL(endpoints[0], c.Command),
+		Endpoints: endpoints,
+		Command:   c.Command,
+		Body:      body,
+		TLS: DryRunTLS{
+			CAFile:     c.CAFile,
+			ServerName: c.CertName,
+			Insecure:   c.Insecure,
+			CertFile:   c.CertFile,
+			KeyFile:    c.KeyFile,
+		},
+	}, nil
+}
+
+// Write the request as text, or as JSON with the json output format.
+func (r DryRunRequest) Write(w io.Writer, format string) error {
+	if format == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(r)
+	}
+
+	_, err := fmt.Fprintf(w, `URL:         %s
+Endpoints:   %s
+Command:     %s
+Body:        %s
+CA file:     %s
+Server name: %s
+Insecure:    %t
+Client cert: %s
+Client key:  %s
+`, r.URL, strings.Join(r.Endpoints, ", "), r.Command, r.Body,
+		r.TLS.CAFile, r.TLS.ServerName, r.TLS.Insecure, r.TLS.CertFile, r.TLS.KeyFile)
+
+	return err
+}
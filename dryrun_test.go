@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunRequest(t *testing.T) {
+	config, err := ParseConfigFromFlags([]string{
+		"--dry-run", "--output", "json", "--api", "https://a:5668, https://b:5668/", "--state-file", "",
+		"--cert-name", "agent.example.com", "--ca-file", "ca.crt", "--insecure",
+		"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckCPU' ",
+		"-Warning", "80", "-Core", "'_Total'", "-NoPerfData",
+	})
+	assert.NoError(t, err)
+	assert.True(t, config.DryRun)
+
+	request, err := config.DryRunRequest()
+	assert.NoError(t, err)
+
+	var output bytes.Buffer
+
+	assert.NoError(t, request.Write(&output, config.Output))
+
+	var decoded map[string]interface{}
+
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+	assert.Equal(t, map[string]interface{}{
+		"url":       "https://a:5668/v1/checker?command=Invoke-IcingaCheckCPU",
+		"endpoints": []interface{}{"https://a:5668", "https://b:5668"},
+		"command":   "Invoke-IcingaCheckCPU",
+		"body":      map[string]interface{}{"-Warning": float64(80), "-Core": "_Total", "-NoPerfData": true},
+		"tls": map[string]interface{}{
+			"ca_file":     "ca.crt",
+			"server_name": "agent.example.com",
+			"insecure":    true,
+			"cert_file":   "",
+			"key_file":    "",
+		},
+	}, decoded)
+
+	output.Reset()
+
+	assert.NoError(t, request.Write(&output, OutputPlugin))
+	assert.Contains(t, output.String(), "URL:         https://a:5668/v1/checker?command=Invoke-IcingaCheckCPU\n")
+	assert.Contains(t, output.String(), `Body:        {"-Core":"_Total","-NoPerfData":true,"-Warning":80}`+"\n")
+	assert.Contains(t, output.String(), "Insecure:    true\n")
+
+	config.API = ""
+
+	_, err = config.DryRunRequest()
+	assert.ErrorIs(t, err, ErrNoEndpoint)
+}
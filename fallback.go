@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Fallback executes a local command line instead of the API, usually powershell.exe with the original arguments.
+type Fallback struct {
+	// CommandLine to execute, the arguments are appended to it.
+	CommandLine string
+	Arguments   []string
+	Stdout      io.Writer
+	Stderr      io.Writer
+	Logger      *slog.Logger
+}
+
+// Run the fallback command and return its exit code.
+//
+// The command is killed at deadline, which is the deadline of the whole check, so the time already spent on the API
+// is not granted again. The output of the command is passed through to Stdout and Stderr.
+func (f Fallback) Run(deadline time.Time) (int, error) {
+	commandLine := SplitCommandLine(f.CommandLine)
+	if len(commandLine) == 0 {
+		return 0, fmt.Errorf("no fallback command configured")
+	}
+
+	if !time.Now().Before(deadline) {
+		return 0, fmt.Errorf("timeout before fallback command: %w", context.DeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	args := append(commandLine[1:], f.Arguments...)
+
+	f.Logger.Debug("executing fallback command", "command", commandLine[0], "args", args)
+
+	cmd := exec.CommandContext(ctx, commandLine[0], args...) // nolint:gosec // intended configuration
+	cmd.Stdout = f.Stdout
+	cmd.Stderr = f.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return exitErr.ExitCode(), nil
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return 0, fmt.Errorf("timeout during fallback command: %w", ctx.Err())
+		}
+
+		return 0, fmt.Errorf("could not execute fallback command: %w", err)
+	}
+
+	return 0, nil
+}
+
+// SplitCommandLine into its words, double quotes group words containing spaces.
+//
+// Examples:
+//
+//	powershell.exe -NoProfile -> []string{"powershell.exe", "-NoProfile"}
+//	"C:\Program Files\PowerShell\7\pwsh.exe" -NoLogo -> []string{`C:\Program Files\PowerShell\7\pwsh.exe`, "-NoLogo"}
+func SplitCommandLine(commandLine string) (words []string) {
+	var (
+		word    strings.Builder
+		inQuote bool
+		inWord  bool
+	)
+
+	for _, c := range commandLine {
+		switch {
+		case c == '"':
+			inQuote = !inQuote
+			inWord = true
+		case (c == ' ' || c == '\t') && !inQuote:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+			}
+
+			inWord = false
+		default:
+			word.WriteRune(c)
+
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return
+}
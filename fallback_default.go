@@ -0,0 +1,9 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+const (
+	// DefaultFallbackCommand for PowerShell Core, as there is no Windows PowerShell.
+	DefaultFallbackCommand = "pwsh"
+)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFallbackStub(t *testing.T, script string) string {
+	t.Helper()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fallback stub requires a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "powershell.sh")
+
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0700) // nolint:gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestFallbackRun(t *testing.T) {
+	stub := writeFallbackStub(t, `for arg in "$@"; do echo "$arg"; done; exit 2`)
+
+	var stdout bytes.Buffer
+
+	fallback := Fallback{
+		CommandLine: `"` + stub + `" -NoProfile`,
+		Arguments:   []string{"-C", "Invoke-IcingaCheckCPU", "-Warning", "'80'"},
+		Stdout:      &stdout,
+		Logger:      slog.New(slog.NewTextHandler(os.Stdout, nil)),
+	}
+
+	exitCode, err := fallback.Run(time.Now().Add(10 * time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, exitCode)
+	assert.Equal(t, "-NoProfile\n-C\nInvoke-IcingaCheckCPU\n-Warning\n'80'\n", stdout.String())
+}
+
+func TestFallbackRunErrors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	_, err := Fallback{CommandLine: "", Logger: logger}.Run(time.Now().Add(10 * time.Second))
+	assert.Error(t, err)
+
+	_, err = Fallback{CommandLine: filepath.Join(t.TempDir(), "missing"), Logger: logger}.Run(time.Now().Add(10 * time.Second))
+	assert.ErrorContains(t, err, "could not execute fallback command")
+
+	stub := writeFallbackStub(t, "sleep 5")
+
+	start := time.Now()
+
+	_, err = Fallback{CommandLine: stub, Logger: logger}.Run(start.Add(time.Second))
+	assert.ErrorContains(t, err, "timeout during fallback command")
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	// The time of the check is already used up by the API
+	_, err = Fallback{CommandLine: stub, Logger: logger}.Run(start)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	assert.Equal(t, []string{"powershell.exe"}, SplitCommandLine("powershell.exe"))
+	assert.Equal(t, []string{"powershell.exe", "-NoProfile"}, SplitCommandLine("  powershell.exe \t-NoProfile "))
+	assert.Equal(t,
+		[]string{`C:\Program Files\PowerShell\7\pwsh.exe`, "-NoLogo", ""},
+		SplitCommandLine(`"C:\Program Files\PowerShell\7\pwsh.exe" -NoLogo ""`))
+	assert.Empty(t, SplitCommandLine(""))
+}
+
+func TestParseConfigFromFlagsFallback(t *testing.T) {
+	config, err := ParseConfigFromFlags([]string{
+		"--fallback", "--fallback-command", "pwsh -NoProfile",
+		"-C", "Invoke-IcingaCheckCPU", "-Warning", "'80'"})
+	assert.NoError(t, err)
+	assert.True(t, config.Fallback)
+	assert.Equal(t, "pwsh -NoProfile", config.FallbackCommand)
+	assert.Equal(t, []string{"-C", "Invoke-IcingaCheckCPU", "-Warning", "'80'"}, config.PowerShellArguments)
+}
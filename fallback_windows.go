@@ -0,0 +1,5 @@
+package main
+
+const (
+	DefaultFallbackCommand = `C:\Windows\System32\WindowsPowerShell\v1.0\powershell.exe`
+)
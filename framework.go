@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// frameworkRESTAPIDaemon is the background daemon of the Icinga for Windows framework providing the REST API.
+const frameworkRESTAPIDaemon = "Start-IcingaWindowsRESTApi"
+
+// ErrNoFrameworkRESTAPI is returned when the REST API daemon is not configured in the framework.
+var ErrNoFrameworkRESTAPI = errors.New("REST API daemon is not enabled in Icinga for Windows configuration")
+
+// FrameworkRESTAPI are the settings of the REST API daemon, as configured in the Icinga for Windows framework.
+type FrameworkRESTAPI struct {
+	Port           int
+	CertFile       string
+	CertThumbprint string
+}
+
+// frameworkConfig is the part of the framework configuration registering background daemons, e.g.:
+//
+//	{"BackgroundDaemon": {"EnabledDaemons": {"Start-IcingaWindowsRESTApi": {
+//	  "Command": "Start-IcingaWindowsRESTApi", "Arguments": {"-Port": 5668, "-CertFile": "..."}}}}}
+type frameworkConfig struct {
+	BackgroundDaemon struct {
+		EnabledDaemons map[string]struct {
+			Command   string
+			Arguments map[string]interface{}
+		}
+	}
+}
+
+// LoadFrameworkRESTAPI reads the REST API settings from the configuration file of the Icinga for Windows framework.
+func LoadFrameworkRESTAPI(path string) (*FrameworkRESTAPI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Icinga for Windows configuration: %w", err)
+	}
+
+	// PowerShell writes JSON files with a BOM
+	data = []byte(strings.TrimPrefix(string(data), "\ufeff"))
+
+	var config frameworkConfig
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse Icinga for Windows configuration %s: %w", path, err)
+	}
+
+	for name, daemon := range config.BackgroundDaemon.EnabledDaemons {
+		if !strings.EqualFold(name, frameworkRESTAPIDaemon) && !strings.EqualFold(daemon.Command, frameworkRESTAPIDaemon) {
+			continue
+		}
+
+		api := &FrameworkRESTAPI{}
+
+		for key, value := range daemon.Arguments {
+			switch strings.ToLower(strings.TrimPrefix(key, "-")) {
+			case "port":
+				api.Port, err = frameworkArgumentInt(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid REST API port in %s: %w", path, err)
+				}
+			case "certfile":
+				api.CertFile, _ = value.(string)
+			case "certthumbprint":
+				api.CertThumbprint, _ = value.(string)
+			}
+		}
+
+		return api, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNoFrameworkRESTAPI, path)
+}
+
+// URL of the REST API on the local machine, with the default port when none is configured.
+func (f FrameworkRESTAPI) URL() string {
+	if f.Port == 0 {
+		return DefaultAPI
+	}
+
+	return "https://localhost:" + strconv.Itoa(f.Port)
+}
+
+// CertName returns the common name of the certificate configured for the REST API.
+//
+// Empty when no certificate file is configured, e.g. for a thumbprint of the Windows certificate store,
+// where the REST API uses the certificate of the Icinga agent by default.
+func (f FrameworkRESTAPI) CertName() (string, error) {
+	if f.CertFile == "" {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(f.CertFile)
+	if err != nil {
+		return "", fmt.Errorf("could not read REST API certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block != nil {
+		data = block.Bytes
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return "", fmt.Errorf("could not parse REST API certificate %s: %w", f.CertFile, err)
+	}
+
+	return cert.Subject.CommonName, nil
+}
+
+func frameworkArgumentInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+
+	return 0, fmt.Errorf("unexpected value %v", value)
+}
+
+// discoverFrameworkRESTAPI sets API and CertName from the Icinga for Windows configuration,
+// unless they are set otherwise.
+//
+// A missing default configuration file is fine, a missing file set via --framework-config is an error.
+func discoverFrameworkRESTAPI(fs *flag.FlagSet, config *Config) error {
+	if fs.Changed("api") || config.FrameworkConfig == "" {
+		return nil
+	}
+
+	api, err := LoadFrameworkRESTAPI(config.FrameworkConfig)
+	if err != nil {
+		if !fs.Changed("framework-config") && (errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrNoFrameworkRESTAPI)) {
+			return nil
+		}
+
+		return err
+	}
+
+	config.API = api.URL()
+
+	if fs.Changed("cert-name") {
+		return nil
+	}
+
+	name, err := api.CertName()
+	if err != nil {
+		return err
+	}
+
+	if name != "" {
+		config.CertName = name
+	}
+
+	return nil
+}
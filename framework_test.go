@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFrameworkConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	err := os.WriteFile(path, []byte(strings.ReplaceAll(content, `\`, `\\`)), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadFrameworkRESTAPI(t *testing.T) {
+	api, err := LoadFrameworkRESTAPI("testdata/framework/config.json")
+	assert.NoError(t, err)
+	assert.Equal(t, &FrameworkRESTAPI{Port: 5669}, api)
+	assert.Equal(t, "https://localhost:5669", api.URL())
+
+	name, err := api.CertName()
+	assert.NoError(t, err)
+	assert.Empty(t, name)
+
+	_, err = LoadFrameworkRESTAPI("testdata/framework/no-api.json")
+	assert.ErrorIs(t, err, ErrNoFrameworkRESTAPI)
+
+	_, err = LoadFrameworkRESTAPI("testdata/framework/missing.json")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = LoadFrameworkRESTAPI("testdata/connector.yml")
+	assert.ErrorContains(t, err, "could not parse Icinga for Windows configuration")
+
+	assert.Equal(t, DefaultAPI, FrameworkRESTAPI{}.URL())
+}
+
+func TestLoadFrameworkRESTAPICertificate(t *testing.T) {
+	_, _, certFile, _ := writeTestCertificate(t, "api.example.com", nil, nil)
+
+	path := writeTestFrameworkConfig(t, `{"BackgroundDaemon": {"EnabledDaemons": {"restapi": {
+		"Command": "Start-IcingaWindowsRESTApi", "Arguments": {"-Port": "5670", "-CertFile": "`+certFile+`"}}}}}`)
+
+	api, err := LoadFrameworkRESTAPI(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &FrameworkRESTAPI{Port: 5670, CertFile: certFile}, api)
+
+	name, err := api.CertName()
+	assert.NoError(t, err)
+	assert.Equal(t, "api.example.com", name)
+
+	api.CertFile = path
+
+	_, err = api.CertName()
+	assert.ErrorContains(t, err, "could not parse REST API certificate")
+
+	path = writeTestFrameworkConfig(t, `{"BackgroundDaemon": {"EnabledDaemons": {"Start-IcingaWindowsRESTApi": {
+		"Arguments": {"-Port": true}}}}}`)
+
+	_, err = LoadFrameworkRESTAPI(path)
+	assert.ErrorContains(t, err, "invalid REST API port")
+}
+
+func TestParseConfigFromFlagsFramework(t *testing.T) {
+	args := []string{"-C", "Invoke-IcingaCheckCPU"}
+
+	_, _, certFile, _ := writeTestCertificate(t, "api.example.com", nil, nil)
+	withCert := writeTestFrameworkConfig(t, `{"BackgroundDaemon": {"EnabledDaemons": {"Start-IcingaWindowsRESTApi": {
+		"Arguments": {"-Port": 5670, "-CertFile": "`+certFile+`"}}}}}`)
+
+	config, err := ParseConfigFromFlags(append([]string{"--framework-config", "testdata/framework/config.json"}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:5669", config.API)
+
+	config, err = ParseConfigFromFlags(append([]string{"--framework-config", withCert}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:5670", config.API)
+	assert.Equal(t, "api.example.com", config.CertName)
+
+	// explicit settings win
+	config, err = ParseConfigFromFlags(append([]string{
+		"--framework-config", withCert, "--api", "https://other:5668", "--cert-name", "other"}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://other:5668", config.API)
+	assert.Equal(t, "other", config.CertName)
+
+	config, err = ParseConfigFromFlags(append([]string{"--framework-config", withCert, "--cert-name", "other"}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://localhost:5670", config.API)
+	assert.Equal(t, "other", config.CertName)
+
+	// a missing configuration is only fine for the default
+	_, err = ParseConfigFromFlags(append([]string{"--framework-config", "testdata/framework/missing.json"}, args...))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	config, err = ParseConfigFromFlags(append([]string{"--framework-config", ""}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAPI, config.API)
+
+	t.Setenv("ICINGA_PSC_API", "https://env:5668")
+
+	config, err = ParseConfigFromFlags(append([]string{"--framework-config", withCert}, args...))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://env:5668", config.API)
+}
@@ -1,23 +1,46 @@
 package main
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"os"
+	"strings"
 )
 
 const (
-	IcingaDataPath = IcingaStatePrefix + "/lib/icinga2"
-	IcingaCAPath   = IcingaDataPath + "/certs/ca.crt"
-	IcingaVarsFile = IcingaStatePrefix + "/cache/icinga2/icinga2.vars"
+	IcingaDataPath  = IcingaStatePrefix + "/lib/icinga2"
+	IcingaCertsPath = IcingaDataPath + "/certs"
+	IcingaCAPath    = IcingaCertsPath + "/ca.crt"
+	IcingaVarsFile  = IcingaStatePrefix + "/cache/icinga2/icinga2.vars"
+
+	IcingaConfigPath    = IcingaConfigPrefix + "/icinga2"
+	IcingaConstantsFile = IcingaConfigPath + "/constants.conf"
+	IcingaZonesFile     = IcingaConfigPath + "/zones.conf"
 )
 
 type IcingaVar struct {
-	Name  string
-	Value string
+	Name string
+	// Value can be any JSON type, numbers are kept as json.Number.
+	Value interface{}
+}
+
+// IcingaPaths locate the files of the local Icinga agent, to be configured for non-standard installs.
+type IcingaPaths struct {
+	VarsFile      string
+	ConstantsFile string
+	ZonesFile     string
+	CertsDir      string
 }
 
+// IcingaVariables are the variables of icinga2.vars by name, see the typed accessors.
+type IcingaVariables map[string]interface{}
+
 func LoadIcingaCACert(path string) *x509.CertPool {
 	if path == "" {
 		path = IcingaCAPath
@@ -40,45 +63,265 @@ func LoadIcingaCACert(path string) *x509.CertPool {
 	return pool
 }
 
+// DefaultIcingaPaths returns the paths of a standard installation of the platform.
+func DefaultIcingaPaths() IcingaPaths {
+	return IcingaPaths{
+		VarsFile:      IcingaVarsFile,
+		ConstantsFile: IcingaConstantsFile,
+		ZonesFile:     IcingaZonesFile,
+		CertsDir:      IcingaCertsPath,
+	}
+}
+
+// NodeCertificate returns the paths of the certificate and key of nodeName in CertsDir.
+//
+// Empty paths are returned, when the files do not exist.
+func (p IcingaPaths) NodeCertificate(nodeName string) (certFile, keyFile string) {
+	if nodeName == "" || p.CertsDir == "" {
+		return
+	}
+
+	certFile = p.CertsDir + "/" + nodeName + ".crt"
+	keyFile = p.CertsDir + "/" + nodeName + ".key"
+
+	for _, path := range []string{certFile, keyFile} {
+		if _, err := os.Stat(path); err != nil {
+			return "", ""
+		}
+	}
+
+	return
+}
+
+// ErrNoNodeName is returned when the NodeName of the Icinga agent can not be determined.
+var ErrNoNodeName = errors.New("could not determine NodeName of the Icinga agent")
+
+// IcingaVarsError is returned for a malformed entry of icinga2.vars.
+type IcingaVarsError struct {
+	Path string
+	// Entry is the number of the entry, starting at 1.
+	Entry int
+	// Offset is the byte offset the entry starts at.
+	Offset int64
+	Err    error
+}
+
+func (e *IcingaVarsError) Error() string {
+	return fmt.Sprintf("%s: entry %d at byte %d: %s", e.Path, e.Entry, e.Offset, e.Err)
+}
+
+func (e *IcingaVarsError) Unwrap() error {
+	return e.Err
+}
+
+// GetIcingaNodeName returns NodeName of the default paths, empty when it can not be determined.
 func GetIcingaNodeName() string {
-	vars := LoadIcingaVariables("")
-	return vars["NodeName"]
+	name, _ := DefaultIcingaPaths().NodeName()
+	return name
+}
+
+// NodeName returns NodeName of the local agent, or ErrNoNodeName with the reason.
+//
+// When icinga2.vars has not been generated yet, NodeName is read from constants.conf,
+// or the local Endpoint of zones.conf.
+func (p IcingaPaths) NodeName() (string, error) {
+	vars, err := p.Variables()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrNoNodeName, err)
+	}
+
+	name, ok := vars.String("NodeName")
+	if !ok || name == "" {
+		return "", fmt.Errorf("%w: no NodeName in %s", ErrNoNodeName, p.sources())
+	}
+
+	return name, nil
+}
+
+// Variables reads VarsFile, falling back to the constants of ConstantsFile when it does not exist.
+//
+// NodeName is then taken from the local Endpoint of ZonesFile, unless declared as constant.
+func (p IcingaPaths) Variables() (IcingaVariables, error) {
+	vars, err := ReadIcingaVariables(p.VarsFile)
+	if !errors.Is(err, os.ErrNotExist) {
+		return vars, err
+	}
+
+	vars, found, err := p.configVariables()
+	if err != nil {
+		return vars, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("could not find %s", p.sources())
+	}
+
+	return vars, nil
+}
+
+// configVariables reads constants.conf and zones.conf, found is false when neither exists.
+func (p IcingaPaths) configVariables() (vars IcingaVariables, found bool, err error) {
+	vars = IcingaVariables{}
+
+	if p.ConstantsFile != "" {
+		constants, err := LoadIcingaConfig(p.ConstantsFile, nil)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, false, err
+		}
+
+		if err == nil {
+			vars, found = constants.Constants, true
+		}
+	}
+
+	if name, _ := vars.String("NodeName"); name != "" || p.ZonesFile == "" {
+		return vars, found, nil
+	}
+
+	zones, err := LoadIcingaConfig(p.ZonesFile, vars)
+	if errors.Is(err, os.ErrNotExist) {
+		return vars, found, nil
+	} else if err != nil {
+		return vars, found, err
+	}
+
+	if name := zones.LocalEndpoint(); name != "" {
+		vars["NodeName"] = name
+	}
+
+	return vars, true, nil
 }
 
-func LoadIcingaVariables(path string) (vars map[string]string) {
+func (p IcingaPaths) sources() string {
+	var paths []string
+
+	for _, path := range []string{p.VarsFile, p.ConstantsFile, p.ZonesFile} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return strings.Join(paths, ", ")
+}
+
+// LoadIcingaVariables reads all variables of the vars file at path, errors are only logged.
+func LoadIcingaVariables(path string) IcingaVariables {
+	vars, err := ReadIcingaVariables(path)
+	if err != nil {
+		slog.Error("could not read vars file", "error", err)
+	}
+
+	return vars
+}
+
+// ReadIcingaVariables reads all variables of the vars file at path.
+//
+// A malformed entry returns an IcingaVarsError, together with the variables read until then.
+func ReadIcingaVariables(path string) (IcingaVariables, error) {
 	if path == "" {
 		path = IcingaVarsFile
 	}
 
-	vars = map[string]string{}
-
 	fh, err := os.Open(path)
 	if err != nil {
-		slog.Error("could not read vars file", "path", path)
-
-		return nil
+		return nil, fmt.Errorf("could not read vars file: %w", err)
 	}
 
+	defer fh.Close()
+
 	var (
-		entry []byte
-		v     IcingaVar
+		vars   = IcingaVariables{}
+		r      = NewNetstringReader(fh)
+		offset int64
 	)
 
-	for {
-		entry, err = ParseNetstring(fh)
-		if err != nil || entry == nil {
-			// TODO: handle error?
-			break
+	for entry := 1; ; entry++ {
+		offset = r.Offset()
+
+		data, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return vars, nil
 		}
 
-		err = json.Unmarshal(entry, &v)
 		if err != nil {
-			// TODO: handle error? - non string can not be parsed currently
-			continue
+			return vars, &IcingaVarsError{Path: path, Entry: entry, Offset: offset, Err: err}
+		}
+
+		var v IcingaVar
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+
+		err = decoder.Decode(&v)
+		if err != nil {
+			return vars, &IcingaVarsError{Path: path, Entry: entry, Offset: offset, Err: fmt.Errorf("invalid JSON: %w", err)}
 		}
 
 		vars[v.Name] = v.Value
 	}
+}
+
+// String returns the variable, when it is a string.
+func (v IcingaVariables) String(name string) (string, bool) {
+	s, ok := v[name].(string)
+	return s, ok
+}
+
+// Int returns the variable, when it is a whole number, like MaxConcurrentChecks.
+func (v IcingaVariables) Int(name string) (int64, bool) {
+	number, ok := v[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
 
-	return
+	if i, err := number.Int64(); err == nil {
+		return i, true
+	}
+
+	// Icinga writes numbers as float, e.g. 512.0
+	f, err := number.Float64()
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+		return 0, false
+	}
+
+	return int64(f), true
+}
+
+// Float returns the variable, when it is a number.
+func (v IcingaVariables) Float(name string) (float64, bool) {
+	number, ok := v[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
+
+	f, err := number.Float64()
+
+	return f, err == nil
+}
+
+// Bool returns the variable, when it is a boolean.
+func (v IcingaVariables) Bool(name string) (bool, bool) {
+	b, ok := v[name].(bool)
+	return b, ok
+}
+
+// Strings returns the variable, when it is an array of strings.
+func (v IcingaVariables) Strings(name string) ([]string, bool) {
+	array, ok := v[name].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	values := make([]string, 0, len(array))
+
+	for _, value := range array {
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+
+		values = append(values, s)
+	}
+
+	return values, true
 }
@@ -6,4 +6,10 @@ package main
 const (
 	// IcingaStatePrefix with a nonexisting path to the Icinga installation, as the standard path is unknown.
 	IcingaStatePrefix = "/nonexisting"
+
+	// IcingaConfigPrefix with a nonexisting path, like IcingaStatePrefix.
+	IcingaConfigPrefix = "/nonexisting"
+
+	// IcingaFrameworkConfig is empty, as Icinga for Windows is not available.
+	IcingaFrameworkConfig = ""
 )
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// IcingaObject is an Endpoint or Zone declaration of the Icinga 2 DSL, like object Endpoint "name" { host = "..." }.
+type IcingaObject struct {
+	Type string
+	Name string
+	// Attributes with a value that could be evaluated, see IcingaVariables for the types.
+	Attributes IcingaVariables
+}
+
+// IcingaConfig are the constants and the Endpoint and Zone objects declared in an Icinga 2 configuration file.
+type IcingaConfig struct {
+	Constants IcingaVariables
+	Objects   []IcingaObject
+}
+
+// icingaToken is a word, a string literal or a single punctuation character.
+type icingaToken struct {
+	text string
+	str  bool
+	line int
+}
+
+// LoadIcingaConfig parses the Icinga 2 configuration file at path, see ParseIcingaConfig.
+func LoadIcingaConfig(path string, constants IcingaVariables) (*IcingaConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Icinga configuration: %w", err)
+	}
+
+	config, err := ParseIcingaConfig(string(data), constants)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// ParseIcingaConfig parses the declarations of constants.conf and zones.conf needed to find the NodeName:
+//
+//	const NodeName = "agent.example.com"
+//	object Endpoint NodeName { host = "agent.example.com" }
+//	object Zone "agent.example.com" { endpoints = [ NodeName ]; parent = "master" }
+//
+// Values can be strings, numbers, booleans, arrays and references to constants, strings also concatenated with +.
+// constants are known before, e.g. from constants.conf when parsing zones.conf. Any other statement, object
+// or value is skipped.
+func ParseIcingaConfig(data string, constants IcingaVariables) (*IcingaConfig, error) {
+	tokens, err := tokenizeIcingaConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &icingaConfigParser{tokens: tokens, constants: IcingaVariables{}}
+	for name, value := range constants {
+		p.constants[name] = value
+	}
+
+	config := &IcingaConfig{Constants: IcingaVariables{}}
+
+	for !p.eof() {
+		switch token := p.next(); {
+		case token.str:
+		case token.text == "const":
+			name := p.next()
+			if name.str || !p.is("=") {
+				return nil, fmt.Errorf("line %d: expected name and = after const", token.line)
+			}
+
+			p.next()
+
+			if value, ok := p.parseExpression(); ok {
+				p.constants[name.text] = value
+				config.Constants[name.text] = value
+			}
+		case token.text == "object":
+			object, err := p.parseObject(token.line)
+			if err != nil {
+				return nil, err
+			}
+
+			if object.Name != "" && (object.Type == "Endpoint" || object.Type == "Zone") {
+				config.Objects = append(config.Objects, object)
+			}
+		case token.text == "{":
+			// skip blocks of other statements, like apply rules
+			p.skipBlock()
+		}
+	}
+
+	return config, nil
+}
+
+// LocalEndpoint returns the Endpoint of the local node in zones.conf, empty when it can not be determined.
+//
+// That is the only endpoint of a zone with a parent, or else the only endpoint without a host to connect to.
+func (c IcingaConfig) LocalEndpoint() string {
+	var candidates []string
+
+	for _, zone := range c.Objects {
+		if zone.Type != "Zone" {
+			continue
+		}
+
+		if _, ok := zone.Attributes.String("parent"); !ok {
+			continue
+		}
+
+		if global, _ := zone.Attributes.Bool("global"); global {
+			continue
+		}
+
+		endpoints, _ := zone.Attributes.Strings("endpoints")
+		candidates = append(candidates, endpoints...)
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	candidates = nil
+
+	for _, endpoint := range c.Objects {
+		if endpoint.Type != "Endpoint" {
+			continue
+		}
+
+		if _, ok := endpoint.Attributes["host"]; !ok {
+			candidates = append(candidates, endpoint.Name)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	return ""
+}
+
+type icingaConfigParser struct {
+	tokens    []icingaToken
+	pos       int
+	constants IcingaVariables
+}
+
+func (p *icingaConfigParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *icingaConfigParser) next() icingaToken {
+	if p.eof() {
+		return icingaToken{}
+	}
+
+	p.pos++
+
+	return p.tokens[p.pos-1]
+}
+
+// is reports whether the next token is the punctuation or word text.
+func (p *icingaConfigParser) is(text string) bool {
+	return !p.eof() && !p.tokens[p.pos].str && p.tokens[p.pos].text == text
+}
+
+// parseObject parses Type name { attributes }, after the object keyword in line.
+//
+// Name is empty, when it can not be evaluated. Attributes that can not be evaluated are skipped.
+func (p *icingaConfigParser) parseObject(line int) (object IcingaObject, err error) {
+	object.Type = p.next().text
+	object.Attributes = IcingaVariables{}
+
+	if name, ok := p.parseExpression(); ok {
+		object.Name, _ = name.(string)
+	}
+
+	// skip anything up to the body, like ignore_on_error
+	for !p.eof() && !p.is("{") {
+		p.next()
+	}
+
+	p.next()
+
+	for !p.is("}") {
+		if p.eof() {
+			return object, fmt.Errorf("line %d: missing } of object %s", line, object.Type)
+		}
+
+		token := p.next()
+
+		switch {
+		case token.str:
+		case token.text == "{" || token.text == "(" || token.text == "[":
+			p.skipBlock()
+		case p.is("="):
+			p.next()
+
+			if value, ok := p.parseExpression(); ok {
+				object.Attributes[token.text] = value
+			}
+		}
+	}
+
+	p.next()
+
+	return object, nil
+}
+
+// parseExpression parses a value, or strings concatenated with +. Nothing is consumed, when it fails.
+func (p *icingaConfigParser) parseExpression() (value interface{}, ok bool) {
+	start := p.pos
+
+	value, ok = p.parseValue()
+
+	for ok && p.is("+") {
+		p.next()
+
+		other, valid := p.parseValue()
+		left, leftString := value.(string)
+		right, rightString := other.(string)
+
+		value, ok = left+right, valid && leftString && rightString
+	}
+
+	if !ok {
+		p.pos = start
+	}
+
+	return
+}
+
+func (p *icingaConfigParser) parseValue() (interface{}, bool) {
+	if p.eof() {
+		return nil, false
+	}
+
+	token := p.next()
+
+	switch {
+	case token.str:
+		return token.text, true
+	case token.text == "true" || token.text == "false":
+		return token.text == "true", true
+	case token.text[0] >= '0' && token.text[0] <= '9':
+		return json.Number(token.text), json.Valid([]byte(token.text))
+	case token.text == "[":
+		array := []interface{}{}
+
+		for !p.is("]") {
+			value, ok := p.parseExpression()
+			if !ok {
+				return nil, false
+			}
+
+			array = append(array, value)
+
+			if p.is(",") {
+				p.next()
+			} else if !p.is("]") {
+				return nil, false
+			}
+		}
+
+		p.next()
+
+		return array, true
+	}
+
+	value, ok := p.constants[token.text]
+
+	return value, ok
+}
+
+// skipBlock skips all tokens up to the bracket closing an opened one.
+func (p *icingaConfigParser) skipBlock() {
+	for depth := 1; !p.eof() && depth > 0; {
+		switch token := p.next(); {
+		case token.str:
+		case token.text == "{" || token.text == "(" || token.text == "[":
+			depth++
+		case token.text == "}" || token.text == ")" || token.text == "]":
+			depth--
+		}
+	}
+}
+
+// tokenizeIcingaConfig splits data into words, string literals and punctuation, comments are dropped.
+//
+// Words are names, dotted names like vars.os and numbers. A backslash in a string escapes the next character.
+func tokenizeIcingaConfig(data string) (tokens []icingaToken, err error) {
+	line := 1
+
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '\n':
+			line++
+		case c == ' ' || c == '\t' || c == '\r':
+		case c == '#' || strings.HasPrefix(data[i:], "//"):
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(data[i:], "/*"):
+			end := strings.Index(data[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: missing end of comment", line)
+			}
+
+			line += strings.Count(data[i:i+2+end], "\n")
+			i += end + 3
+		case c == '"':
+			var s strings.Builder
+
+			start := line
+
+			for i++; i < len(data) && data[i] != '"'; i++ {
+				if data[i] == '\\' && i+1 < len(data) {
+					i++
+				}
+
+				if data[i] == '\n' {
+					line++
+				}
+
+				s.WriteByte(data[i])
+			}
+
+			if i >= len(data) {
+				return nil, fmt.Errorf("line %d: missing end of string", start)
+			}
+
+			tokens = append(tokens, icingaToken{text: s.String(), str: true, line: start})
+		case isIcingaWordChar(c):
+			start := i
+			for i+1 < len(data) && isIcingaWordChar(data[i+1]) {
+				i++
+			}
+
+			tokens = append(tokens, icingaToken{text: data[start : i+1], line: line})
+		default:
+			tokens = append(tokens, icingaToken{text: string(c), line: line})
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIcingaWordChar(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadIcingaConfigConstants(t *testing.T) {
+	config, err := LoadIcingaConfig("testdata/icinga2/constants.conf", nil)
+	assert.NoError(t, err)
+
+	vars := config.Constants
+
+	name, _ := vars.String("NodeName")
+	assert.Equal(t, "agent.example.com", name)
+
+	zone, _ := vars.String("ZoneName")
+	assert.Equal(t, "agent.example.com", zone)
+
+	dir, _ := vars.String("ManubulonPluginDir")
+	assert.Equal(t, "/usr/lib/nagios/plugins", dir)
+
+	dir, _ = vars.String("PluginContribDir")
+	assert.Equal(t, "/usr/lib/nagios/plugins/contrib", dir)
+
+	maxChecks, ok := vars.Int("MaxConcurrentChecks")
+	assert.True(t, ok)
+	assert.Equal(t, int64(512), maxChecks)
+
+	enabled, _ := vars.Bool("Enabled")
+	assert.True(t, enabled)
+
+	salt, ok := vars.String("TicketSalt")
+	assert.True(t, ok)
+	assert.Equal(t, "", salt)
+}
+
+func TestLoadIcingaConfigZones(t *testing.T) {
+	config, err := LoadIcingaConfig("testdata/icinga2/zones.conf", nil)
+	assert.NoError(t, err)
+	assert.Len(t, config.Objects, 6)
+
+	master := config.Objects[0]
+	assert.Equal(t, "Endpoint", master.Type)
+	assert.Equal(t, "master.example.com", master.Name)
+
+	host, _ := master.Attributes.String("host")
+	assert.Equal(t, "master.example.com", host)
+
+	assert.Equal(t, "agent.example.com", config.LocalEndpoint())
+}
+
+func TestParseIcingaConfig(t *testing.T) {
+	data := `
+# generated by the node wizard
+const Domain = "example.com"; const NodeName = "agent." + Domain
+const Prefix = PrefixDir + "/lib" // unknown constants are skipped
+const Escaped = "say \"hi\""
+
+object Endpoint NodeName {
+	log_duration = 1d
+	vars.ports = [ 5665, "5666" ]
+	vars.ignored = function() { return "x" }
+	port = "5665"
+}
+
+object Host NodeName { address = "192.0.2.2" } // only Endpoint and Zone objects are parsed
+
+apply Service "ping" {
+	object = "not an object"
+	assign where host.name == NodeName
+}
+
+object Zone ZoneName { endpoints = [ NodeName ] } // unknown name is skipped
+object Zone "agent.example.com" { endpoints = [ NodeName ]; parent = "master" }
+`
+
+	config, err := ParseIcingaConfig(data, IcingaVariables{"Known": "value"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, IcingaVariables{
+		"Domain":   "example.com",
+		"NodeName": "agent.example.com",
+		"Escaped":  "say \"hi\"",
+	}, config.Constants)
+
+	assert.Equal(t, []IcingaObject{
+		{Type: "Endpoint", Name: "agent.example.com", Attributes: IcingaVariables{
+			"vars.ports": []interface{}{json.Number("5665"), "5666"},
+			"port":       "5665",
+		}},
+		{Type: "Zone", Name: "agent.example.com", Attributes: IcingaVariables{
+			"endpoints": []interface{}{"agent.example.com"},
+			"parent":    "master",
+		}},
+	}, config.Objects)
+
+	assert.Equal(t, "agent.example.com", config.LocalEndpoint())
+
+	for _, invalid := range []string{
+		`const NodeName = "agent`,
+		`/* not closed`,
+		`object Endpoint "agent" { host = "agent"`,
+		`const = "agent"`,
+		`object Endpoint "agent"`,
+	} {
+		_, err = ParseIcingaConfig(invalid, nil)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestIcingaConfigLocalEndpoint(t *testing.T) {
+	// Without zones, the only endpoint without a host is local
+	config, err := ParseIcingaConfig(`
+object Endpoint "master" { host = "192.0.2.1" }
+object Endpoint "agent" { }
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent", config.LocalEndpoint())
+
+	// Ambiguous
+	config, err = ParseIcingaConfig(`
+object Endpoint "agent1" { }
+object Endpoint "agent2" { }
+`, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", config.LocalEndpoint())
+}
@@ -1,5 +1,9 @@
 package main
 
 const (
-	IcingaStatePrefix = "/var"
+	IcingaStatePrefix  = "/var"
+	IcingaConfigPrefix = "/etc"
+
+	// IcingaFrameworkConfig is empty, as Icinga for Windows is usually not installed on Linux.
+	IcingaFrameworkConfig = ""
 )
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,4 +18,228 @@ func TestLoadIcingaVariables(t *testing.T) {
 
 	assert.Equal(t, "icinga.example.com", vars["NodeName"])
 	assert.Equal(t, "secret", vars["TicketSalt"])
+
+	// Numbers are no longer skipped
+	maxChecks, ok := vars.Int("MaxConcurrentChecks")
+	assert.True(t, ok)
+	assert.Equal(t, int64(512), maxChecks)
+}
+
+func TestIcingaVariablesTyped(t *testing.T) {
+	var data bytes.Buffer
+
+	writer := NewNetstringWriter(&data)
+
+	for _, entry := range []string{
+		`{"name":"NodeName","value":"agent.example.com"}`,
+		`{"name":"MaxConcurrentChecks","value":512.0}`,
+		`{"name":"Ratio","value":0.5}`,
+		`{"name":"Big","value":9007199254740993}`,
+		`{"name":"Enabled","value":true}`,
+		`{"name":"Endpoints","value":["master1","master2"]}`,
+		`{"name":"Mixed","value":["master1",2]}`,
+		`{"name":"Build","value":{"Version":"r2.14.0"}}`,
+	} {
+		assert.NoError(t, writer.Write([]byte(entry)))
+	}
+
+	assert.NoError(t, writer.Flush())
+
+	path := filepath.Join(t.TempDir(), "icinga2.vars")
+	assert.NoError(t, os.WriteFile(path, data.Bytes(), 0600))
+
+	vars := LoadIcingaVariables(path)
+	assert.Len(t, vars, 8)
+
+	s, ok := vars.String("NodeName")
+	assert.True(t, ok)
+	assert.Equal(t, "agent.example.com", s)
+
+	_, ok = vars.String("MaxConcurrentChecks")
+	assert.False(t, ok)
+
+	i, ok := vars.Int("MaxConcurrentChecks")
+	assert.True(t, ok)
+	assert.Equal(t, int64(512), i)
+
+	i, ok = vars.Int("Big")
+	assert.True(t, ok)
+	assert.Equal(t, int64(9007199254740993), i)
+
+	_, ok = vars.Int("Ratio")
+	assert.False(t, ok)
+
+	f, ok := vars.Float("Ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, f)
+
+	_, ok = vars.Float("NodeName")
+	assert.False(t, ok)
+
+	b, ok := vars.Bool("Enabled")
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	_, ok = vars.Bool("Missing")
+	assert.False(t, ok)
+
+	strings, ok := vars.Strings("Endpoints")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"master1", "master2"}, strings)
+
+	_, ok = vars.Strings("Mixed")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]interface{}{"Version": "r2.14.0"}, vars["Build"])
+}
+
+func TestIcingaPathsNodeCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, keyFile := IcingaPaths{CertsDir: dir}.NodeCertificate("")
+	assert.Empty(t, certFile)
+	assert.Empty(t, keyFile)
+
+	certFile, keyFile = IcingaPaths{CertsDir: dir}.NodeCertificate("agent.example.com")
+	assert.Empty(t, certFile)
+	assert.Empty(t, keyFile)
+
+	for _, name := range []string{"agent.example.com.crt", "agent.example.com.key"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	certFile, keyFile = IcingaPaths{CertsDir: dir}.NodeCertificate("agent.example.com")
+	assert.Equal(t, dir+"/agent.example.com.crt", certFile)
+	assert.Equal(t, dir+"/agent.example.com.key", keyFile)
+}
+
+func TestReadIcingaVariablesErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	testcases := []struct {
+		name   string
+		data   string
+		entry  int
+		offset int64
+		err    string
+	}{
+		{
+			name:   "truncated",
+			data:   `48:{"name":"NodeName","value":"icinga.example.com"},38:{"name":"TicketSalt"`,
+			entry:  2,
+			offset: 52,
+			err:    "failed reading netstring content: unexpected EOF",
+		},
+		{
+			name:   "json",
+			data:   `5:hello,48:{"name":"NodeName","value":"icinga.example.com"},`,
+			entry:  1,
+			offset: 0,
+			err:    "invalid JSON",
+		},
+		{
+			name:   "length",
+			data:   "48:{\"name\":\"NodeName\",\"value\":\"icinga.example.com\"},\nx:",
+			entry:  2,
+			offset: 52,
+			err:    "invalid netstring length: invalid char 'x'",
+		},
+		{
+			name:   "terminator",
+			data:   `48:{"name":"NodeName","value":"icinga.example.com"};`,
+			entry:  1,
+			offset: 0,
+			err:    "missing netstring terminator",
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name+".vars")
+			assert.NoError(t, os.WriteFile(path, []byte(test.data), 0600))
+
+			_, err := ReadIcingaVariables(path)
+
+			var varsErr *IcingaVarsError
+
+			if assert.ErrorAs(t, err, &varsErr) {
+				assert.Equal(t, path, varsErr.Path)
+				assert.Equal(t, test.entry, varsErr.Entry)
+				assert.Equal(t, test.offset, varsErr.Offset)
+				assert.ErrorContains(t, err, test.err)
+			}
+
+			_, err = IcingaPaths{VarsFile: path}.NodeName()
+			assert.ErrorIs(t, err, ErrNoNodeName)
+		})
+	}
+
+	_, err := ReadIcingaVariables(filepath.Join(dir, "missing.vars"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	name, err := IcingaPaths{VarsFile: "testdata/icinga2.vars"}.NodeName()
+	assert.NoError(t, err)
+	assert.Equal(t, "icinga.example.com", name)
+
+	path := filepath.Join(dir, "empty.vars")
+	assert.NoError(t, os.WriteFile(path, nil, 0600))
+
+	_, err = IcingaPaths{VarsFile: path}.NodeName()
+	assert.EqualError(t, err, "could not determine NodeName of the Icinga agent: no NodeName in "+path)
+}
+
+func TestIcingaPathsFallback(t *testing.T) {
+	dir := t.TempDir()
+
+	paths := IcingaPaths{
+		VarsFile:      filepath.Join(dir, "icinga2.vars"),
+		ConstantsFile: "testdata/icinga2/constants.conf",
+		ZonesFile:     "testdata/icinga2/zones.conf",
+	}
+
+	vars, err := paths.Variables()
+	assert.NoError(t, err)
+
+	pluginDir, _ := vars.String("PluginDir")
+	assert.Equal(t, "/usr/lib/nagios/plugins", pluginDir)
+
+	name, err := paths.NodeName()
+	assert.NoError(t, err)
+	assert.Equal(t, "agent.example.com", name)
+
+	// NodeName from the local endpoint of zones.conf
+	constants := filepath.Join(dir, "constants.conf")
+	assert.NoError(t, os.WriteFile(constants, []byte(`const PluginDir = "/usr/lib/nagios/plugins"`), 0600))
+
+	paths.ConstantsFile = constants
+
+	name, err = paths.NodeName()
+	assert.NoError(t, err)
+	assert.Equal(t, "agent.example.com", name)
+
+	// icinga2.vars wins, once generated
+	paths.VarsFile = "testdata/icinga2.vars"
+
+	name, err = paths.NodeName()
+	assert.NoError(t, err)
+	assert.Equal(t, "icinga.example.com", name)
+
+	// Neither file exists
+	paths = IcingaPaths{
+		VarsFile:      filepath.Join(dir, "missing.vars"),
+		ConstantsFile: filepath.Join(dir, "missing.conf"),
+	}
+
+	_, err = paths.NodeName()
+	assert.ErrorIs(t, err, ErrNoNodeName)
+	assert.ErrorContains(t, err, "could not find "+paths.VarsFile+", "+paths.ConstantsFile)
+
+	// Broken files are not skipped
+	broken := filepath.Join(dir, "broken.conf")
+	assert.NoError(t, os.WriteFile(broken, []byte(`const NodeName = "agent`), 0600))
+
+	paths.ConstantsFile = broken
+
+	_, err = paths.NodeName()
+	assert.ErrorContains(t, err, "could not parse "+broken+": line 1: missing end of string")
 }
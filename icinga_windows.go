@@ -1,5 +1,9 @@
 package main
 
 const (
-	IcingaStatePrefix = "C:/ProgramData/icinga2/var"
+	IcingaStatePrefix  = "C:/ProgramData/icinga2/var"
+	IcingaConfigPrefix = "C:/ProgramData/icinga2/etc"
+
+	// IcingaFrameworkConfig is the configuration of the Icinga for Windows framework.
+	IcingaFrameworkConfig = "C:/ProgramData/icinga-powershell-framework/config/config.json"
 )
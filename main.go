@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/NETWAYS/go-check"
 	flag "github.com/spf13/pflag"
@@ -28,13 +31,30 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 `
 
 func main() {
-	config, err := ParseConfigFromFlags(os.Args[1:])
+	args := os.Args[1:]
+
+	var subcommand string
+
+	// serve runs the connector as daemon, keeping connections to the API open,
+	// batch executes all checks read from stdin, list-checks prints the checks available via the API
+	if len(args) > 0 && (args[0] == "serve" || args[0] == "batch" || args[0] == "list-checks") {
+		subcommand = args[0]
+		args = args[1:]
+	}
+
+	config, err := ParseConfigFromFlags(args)
 	if err != nil {
 		if errors.Is(err, ErrVersionRequested) || errors.Is(err, flag.ErrHelp) {
 			os.Exit(check.Unknown)
 		}
 
-		check.ExitError(err)
+		if config == nil {
+			check.ExitError(err)
+		}
+
+		if subcommand == "" || !errors.Is(err, ErrNoCommand) {
+			exitError(config, err)
+		}
 	}
 
 	// Default log options
@@ -42,7 +62,8 @@ func main() {
 		Level: slog.LevelInfo,
 	}
 
-	handler := slog.NewTextHandler(os.Stdout, opts)
+	// stdout is only for the plugin output and results
+	handler := slog.NewTextHandler(os.Stderr, opts)
 
 	if config.Debug {
 		opts.Level = slog.LevelDebug
@@ -51,18 +72,208 @@ func main() {
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
-	api := RestAPI{
-		URL:    config.API,
-		Client: config.NewClient(),
-		Logger: logger,
+	switch subcommand {
+	case "serve":
+		err = runDaemon(config, logger)
+		if err != nil {
+			check.ExitError(err)
+		}
+
+		os.Exit(check.OK)
+	case "batch":
+		err = runBatch(config, logger)
+		if err != nil {
+			check.ExitError(err)
+		}
+
+		os.Exit(check.OK)
+	case "list-checks":
+		err = listChecks(config, logger)
+		if err != nil {
+			check.ExitError(err)
+		}
+
+		os.Exit(check.OK)
+	}
+
+	if config.DryRun {
+		err = printDryRun(config)
+		if err != nil {
+			exitError(config, err)
+		}
+
+		os.Exit(check.OK)
 	}
 
-	result, err := api.ExecuteCheck(config.Command, config.Arguments, config.Timeout)
+	api, err := config.NewRestAPI(logger)
 	if err != nil {
-		check.ExitError(err)
+		exitError(config, err)
+	}
+
+	// The fallback only gets the time left of --timeout
+	deadline := time.Now().Add(time.Duration(config.Timeout) * time.Second)
+
+	result, err := executeCheck(config, api, logger)
+	if err != nil {
+		if config.Fallback && IsConnectionError(err) {
+			logger.Debug("API not reachable, executing fallback", "error", err, "remaining", time.Until(deadline))
+			os.Exit(runFallback(config, deadline, logger))
+		}
+
+		exitError(config, err)
+	}
+
+	if config.Submit {
+		err = submitResult(config, result, logger)
+		if err != nil {
+			exitError(config, err)
+		}
 	}
 
-	_, _ = fmt.Fprintln(os.Stdout, result.String())
+	err = config.NewResultWriter().Write(os.Stdout, result)
+	if err != nil {
+		check.ExitError(err)
+	}
 
 	os.Exit(result.ExitCode)
 }
+
+// exitError exits with UNKNOWN, in the configured output format so automation can still parse it.
+func exitError(config *Config, err error) {
+	if config.Output == OutputPlugin {
+		check.ExitError(err)
+	}
+
+	result := &APICheckResult{ExitCode: check.Unknown, CheckResult: "[UNKNOWN] - " + err.Error()}
+
+	_ = config.NewResultWriter().Write(os.Stdout, result)
+
+	os.Exit(check.Unknown)
+}
+
+// executeCheck forwards the check to a running daemon, on --socket or DefaultSocket, and falls back to the API when
+// there is none.
+func executeCheck(config *Config, api CheckExecutor, logger *slog.Logger) (*APICheckResult, error) {
+	socket := config.Socket
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	return executeCheckVia(config, socket, api, logger)
+}
+
+// executeCheckVia forwards the check to the daemon on socket.
+//
+// A daemon with other connection settings is only an error, when it was configured with --socket. Otherwise the check
+// falls back to the API, like without a daemon.
+func executeCheckVia(config *Config, socket string, api CheckExecutor, logger *slog.Logger) (*APICheckResult, error) {
+	settings := config.DaemonSettings()
+	daemon := DaemonClient{Socket: socket, Settings: &settings, Logger: logger}
+
+	result, err := daemon.ExecuteCheck(config.Command, config.Arguments, config.Timeout)
+
+	switch {
+	case errors.Is(err, ErrDaemonUnavailable):
+		logger.Debug("daemon not available, connecting to API directly", "error", err)
+	case errors.Is(err, ErrDaemonSettings) && config.Socket == "":
+		logger.Debug("daemon uses other connection settings, connecting to API directly", "error", err)
+	default:
+		return result, err
+	}
+
+	return api.ExecuteCheck(config.Command, config.Arguments, config.Timeout)
+}
+
+func printDryRun(config *Config) error {
+	request, err := config.DryRunRequest()
+	if err != nil {
+		return err
+	}
+
+	return request.Write(os.Stdout, config.Output)
+}
+
+func submitResult(config *Config, result *APICheckResult, logger *slog.Logger) error {
+	submitter, err := config.NewSubmitter(logger)
+	if err != nil {
+		return err
+	}
+
+	return submitter.Submit(result, config.Timeout)
+}
+
+func runDaemon(config *Config, logger *slog.Logger) error {
+	daemon, err := NewDaemon(config, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	socket := config.Socket
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	return daemon.ListenAndServe(ctx, socket)
+}
+
+func runBatch(config *Config, logger *slog.Logger) error {
+	requests, err := ReadBatchRequests(os.Stdin, config.BatchFormat)
+	if err != nil {
+		return err
+	}
+
+	api, err := config.NewRestAPI(logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("executing batch", "checks", len(requests), "workers", config.Workers)
+
+	results := RunBatch(config.CommandPolicy().Executor(api), requests, config.Workers, config.Timeout)
+
+	return WriteBatchResults(os.Stdout, config.BatchFormat, results)
+}
+
+func listChecks(config *Config, logger *slog.Logger) error {
+	api, err := config.NewRestAPI(logger)
+	if err != nil {
+		return err
+	}
+
+	commands, err := api.ListChecks(config.Timeout)
+	if err != nil {
+		return err
+	}
+
+	// only list what can be executed
+	policy := config.CommandPolicy()
+	allowed := make([]APICheckCommand, 0, len(commands))
+
+	for _, command := range commands {
+		if policy.Check(command.Name) == nil {
+			allowed = append(allowed, command)
+		}
+	}
+
+	return WriteAPICheckCommands(os.Stdout, config.Output, allowed)
+}
+
+func runFallback(config *Config, deadline time.Time, logger *slog.Logger) int {
+	fallback := Fallback{
+		CommandLine: config.FallbackCommand,
+		Arguments:   config.PowerShellArguments,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		Logger:      logger,
+	}
+
+	exitCode, err := fallback.Run(deadline)
+	if err != nil {
+		check.ExitError(err)
+	}
+
+	return exitCode
+}
@@ -1,61 +1,219 @@
 package main
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 )
 
 const (
-	Separator = ':'
+	Separator  = ':'
+	Terminator = ','
+
+	// DefaultNetstringMaxSize limits the content of a single netstring, unless configured otherwise.
+	DefaultNetstringMaxSize = 16 << 20
 )
 
-func ParseNetstring(r io.Reader) ([]byte, error) {
+var (
+	// ErrNetstringTerminator is returned when a netstring does not end with a comma.
+	ErrNetstringTerminator = errors.New("missing netstring terminator")
+
+	// ErrNetstringTooLarge is returned when the length of a netstring exceeds the maximum size.
+	ErrNetstringTooLarge = errors.New("netstring exceeds maximum size")
+
+	// ErrNetstringLength is returned for a missing or malformed length, like a leading zero.
+	ErrNetstringLength = errors.New("invalid netstring length")
+)
+
+// NetstringReader reads netstrings like 5:hello, from a buffered stream.
+//
+// Line feeds before the length of a netstring are ignored, so netstrings can be separated by newlines.
+type NetstringReader struct {
+	// MaxSize of the content, DefaultNetstringMaxSize when 0.
+	MaxSize int
+
+	r      netstringSource
+	offset int64
+}
+
+// NetstringWriter writes netstrings to a buffered stream, call Flush when done.
+type NetstringWriter struct {
+	// MaxSize of the content, DefaultNetstringMaxSize when 0.
+	MaxSize int
+
+	w *bufio.Writer
+}
+
+type netstringSource interface {
+	io.Reader
+	io.ByteReader
+}
+
+// NewNetstringReader returns a NetstringReader reading from r.
+func NewNetstringReader(r io.Reader) *NetstringReader {
+	return &NetstringReader{r: bufio.NewReader(r)}
+}
+
+// Read the next netstring, io.EOF is returned when the stream ends before a netstring.
+//
+// A netstring truncated in its length, content or terminator returns io.ErrUnexpectedEOF.
+func (n *NetstringReader) Read() ([]byte, error) {
+	length, err := n.readLength()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read netstring content.
+	data := make([]byte, length)
+
+	read, err := io.ReadFull(n.r, data)
+	n.offset += int64(read)
+
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, fmt.Errorf("failed reading netstring content: %w", err)
+	}
+
+	// Read data end char.
+	b, err := n.readByte()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrNetstringTerminator, err)
+	}
+
+	if b != Terminator {
+		return nil, fmt.Errorf("%w: found %q", ErrNetstringTerminator, b)
+	}
+
+	return data, nil
+}
+
+// Offset returns the number of bytes consumed from the stream.
+func (n *NetstringReader) Offset() int64 {
+	return n.offset
+}
+
+// readLength reads the length up to the separator, a leading zero is only allowed for an empty netstring.
+func (n *NetstringReader) readLength() (int, error) {
 	var (
-		char   = make([]byte, 1)
 		length int
-		digit  int
+		digits int
+		zero   bool
 	)
 
-	// Read length from reader.
+	maxSize := n.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultNetstringMaxSize
+	}
+
 	for {
-		_, err := r.Read(char)
+		b, err := n.readByte()
 		if err != nil {
-			if errors.Is(err, io.EOF) {
-				// EOF in length means we reached the end
-				return nil, nil
+			if errors.Is(err, io.EOF) && digits > 0 {
+				return 0, fmt.Errorf("failed reading netstring length: %w", io.ErrUnexpectedEOF)
 			}
 
-			return nil, err
+			// EOF before a length means we reached the end
+			return 0, err
 		}
 
-		b := char[0]
-
-		if b == 10 /* \n */ || b == 13 /* \r */ {
-			// ignore line feeds in length.
+		switch {
+		case (b == '\n' || b == '\r') && digits == 0:
+			// ignore line feeds between netstrings
 			continue
-		} else if b == Separator {
-			break
+		case b == Separator:
+			if digits == 0 {
+				return 0, fmt.Errorf("%w: missing length", ErrNetstringLength)
+			}
+
+			return length, nil
+		case b < '0' || b > '9':
+			return 0, fmt.Errorf("%w: invalid char %q", ErrNetstringLength, b)
+		case zero:
+			return 0, fmt.Errorf("%w: leading zero", ErrNetstringLength)
 		}
 
-		digit = int(b - '0')
-		if (digit < 0) || (digit > 9) {
-			return nil, errors.New("invalid char in netstring length")
+		zero = digits == 0 && b == '0'
+		length = length*10 + int(b-'0')
+		digits++
+
+		if length > maxSize {
+			return 0, fmt.Errorf("%w of %d bytes", ErrNetstringTooLarge, maxSize)
 		}
+	}
+}
 
-		length = length*10 + digit
+func (n *NetstringReader) readByte() (byte, error) {
+	b, err := n.r.ReadByte()
+	if err == nil {
+		n.offset++
 	}
 
-	// Read netstring content.
-	data := make([]byte, length)
+	return b, err
+}
 
-	_, err := r.Read(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed reading netstring content: %w", err)
+// ParseNetstring reads the next netstring from r, nil when the end is reached.
+//
+// Nothing is read beyond the netstring, unlike with a NetstringReader which should be preferred.
+func ParseNetstring(r io.Reader) ([]byte, error) {
+	source, ok := r.(netstringSource)
+	if !ok {
+		source = singleByteReader{r}
 	}
 
-	// Read data end char and ignore possible EOF.
-	_, _ = r.Read(char)
+	data, err := (&NetstringReader{r: source}).Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
 
-	return data, nil
+	return data, err
+}
+
+// singleByteReader reads byte by byte, without buffering ahead.
+type singleByteReader struct {
+	io.Reader
+}
+
+func (r singleByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+
+	_, err := io.ReadFull(r.Reader, b[:])
+
+	return b[0], err
+}
+
+// NewNetstringWriter returns a NetstringWriter writing to w.
+func NewNetstringWriter(w io.Writer) *NetstringWriter {
+	return &NetstringWriter{w: bufio.NewWriter(w)}
+}
+
+// Write data framed as netstring, e.g. 5:hello,
+func (n *NetstringWriter) Write(data []byte) error {
+	maxSize := n.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultNetstringMaxSize
+	}
+
+	if len(data) > maxSize {
+		return fmt.Errorf("%w of %d bytes", ErrNetstringTooLarge, maxSize)
+	}
+
+	_, _ = n.w.WriteString(strconv.Itoa(len(data)))
+	_ = n.w.WriteByte(Separator)
+	_, _ = n.w.Write(data)
+
+	return n.w.WriteByte(Terminator)
+}
+
+// Flush writes all buffered netstrings to the underlying writer.
+func (n *NetstringWriter) Flush() error {
+	return n.w.Flush()
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +31,142 @@ func TestParseNetstring(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, data)
 }
+
+func TestParseNetstringErrors(t *testing.T) {
+	_, err := ParseNetstring(strings.NewReader("5:abc"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = ParseNetstring(strings.NewReader("12"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	_, err = ParseNetstring(strings.NewReader("3:abc"))
+	assert.ErrorIs(t, err, ErrNetstringTerminator)
+
+	_, err = ParseNetstring(strings.NewReader("3:abc;"))
+	assert.ErrorIs(t, err, ErrNetstringTerminator)
+
+	_, err = ParseNetstring(strings.NewReader(":abc,"))
+	assert.ErrorIs(t, err, ErrNetstringLength)
+
+	_, err = ParseNetstring(strings.NewReader("a:abc,"))
+	assert.ErrorIs(t, err, ErrNetstringLength)
+}
+
+func TestNetstringReader(t *testing.T) {
+	// an unbuffered reader, filling only one byte per Read
+	reader := NewNetstringReader(iotest.OneByteReader(strings.NewReader("0:,\r\n3:abc,\n10:0123456789,")))
+
+	for _, expected := range []string{"", "abc", "0123456789"} {
+		data, err := reader.Read()
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(expected), data)
+	}
+
+	assert.Equal(t, int64(26), reader.Offset())
+
+	_, err := reader.Read()
+	assert.ErrorIs(t, err, io.EOF)
+
+	testcases := []struct {
+		input string
+		err   error
+	}{
+		{input: "01:a,", err: ErrNetstringLength},
+		{input: "00:,", err: ErrNetstringLength},
+		{input: "1\n:a,", err: ErrNetstringLength},
+		{input: "-1:a,", err: ErrNetstringLength},
+		{input: "3:abcd", err: ErrNetstringTerminator},
+		{input: "3:ab", err: io.ErrUnexpectedEOF},
+		{input: "11:abcdefghijk,", err: ErrNetstringTooLarge},
+		{input: "99999999999999999999999:", err: ErrNetstringTooLarge},
+	}
+
+	for _, test := range testcases {
+		reader := NewNetstringReader(strings.NewReader(test.input))
+		reader.MaxSize = 10
+
+		_, err := reader.Read()
+		assert.ErrorIs(t, err, test.err, test.input)
+	}
+}
+
+func TestNetstringWriter(t *testing.T) {
+	var output bytes.Buffer
+
+	writer := NewNetstringWriter(&output)
+	writer.MaxSize = 5
+
+	assert.NoError(t, writer.Write([]byte("hello")))
+	assert.NoError(t, writer.Write(nil))
+	assert.ErrorIs(t, writer.Write([]byte("hello!")), ErrNetstringTooLarge)
+	assert.Empty(t, output.String())
+
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, "5:hello,0:,", output.String())
+}
+
+func FuzzNetstringRoundTrip(f *testing.F) {
+	for _, seed := range []string{"", "hello", "1:a,", "\n", ",,::"} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var buf bytes.Buffer
+
+		writer := NewNetstringWriter(&buf)
+		if err := writer.Write(data); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writer.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		reader := NewNetstringReader(&buf)
+
+		read, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, read) {
+			t.Fatalf("read %q, expected %q", read, data)
+		}
+
+		if _, err = reader.Read(); !errors.Is(err, io.EOF) {
+			t.Fatalf("expected EOF, got %v", err)
+		}
+	})
+}
+
+func FuzzNetstringReader(f *testing.F) {
+	for _, seed := range []string{"1:a,5:bbbbb,", "0:,", "01:a,", "3:ab", "\r\n2:ab,", "9999999999999999999:"} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		reader := NewNetstringReader(bytes.NewReader(input))
+		reader.MaxSize = 1024
+
+		for {
+			offset := reader.Offset()
+
+			data, err := reader.Read()
+			if err != nil {
+				return
+			}
+
+			if len(data) > reader.MaxSize {
+				t.Fatalf("netstring of %d bytes exceeds the maximum size", len(data))
+			}
+
+			// a valid netstring is always written the same way
+			encoded := strconv.Itoa(len(data)) + ":" + string(data) + ","
+			consumed := strings.TrimLeft(string(input[offset:reader.Offset()]), "\r\n")
+
+			if consumed != encoded {
+				t.Fatalf("consumed %q for %q", consumed, encoded)
+			}
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	OutputPlugin    = "plugin"
+	OutputJSON      = "json"
+	OutputIcingaAPI = "icinga-api"
+)
+
+// OutputFormats that can be selected with --output.
+var OutputFormats = []string{OutputPlugin, OutputJSON, OutputIcingaAPI}
+
+// CheckResultOutput is the JSON representation of a check result.
+type CheckResultOutput struct {
+	ExitCode int          `json:"exit_code"`
+	Output   string       `json:"output"`
+	Perfdata PerfdataList `json:"perfdata"`
+}
+
+// NewCheckResultOutput builds the JSON representation of result.
+func NewCheckResultOutput(result *APICheckResult) CheckResultOutput {
+	return CheckResultOutput{
+		ExitCode: result.ExitCode,
+		Output:   strings.TrimSpace(result.CheckResult),
+		Perfdata: result.ParsedPerfdata(),
+	}
+}
+
+// ResultWriter writes check results in one of the OutputFormats.
+type ResultWriter struct {
+	Format string
+	// Submitter provides host, service and check source for the icinga-api format.
+	Submitter Submitter
+}
+
+// IsOutputFormat returns true for a supported output format.
+func IsOutputFormat(format string) bool {
+	for _, f := range OutputFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Write result to w in the configured format.
+func (o ResultWriter) Write(w io.Writer, result *APICheckResult) error {
+	var value interface{}
+
+	switch o.Format {
+	case OutputPlugin, "":
+		_, err := fmt.Fprintln(w, result.String())
+		return err
+	case OutputJSON:
+		value = NewCheckResultOutput(result)
+	case OutputIcingaAPI:
+		value = o.Submitter.NewProcessCheckResultPayload(result)
+	default:
+		return fmt.Errorf("unknown output format: %s", o.Format)
+	}
+
+	encoder := json.NewEncoder(w)
+	// keep filters like && readable
+	encoder.SetEscapeHTML(false)
+
+	return encoder.Encode(value)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultWriter(t *testing.T) {
+	result := &APICheckResult{
+		ExitCode:    1,
+		CheckResult: "[WARNING] CPU\n",
+		Perfdata:    APIPerfdataList{"'load'=90%;80;95;0;100", "broken", "'last run'=U"},
+	}
+
+	testcases := []struct {
+		writer   ResultWriter
+		expected string
+	}{
+		{
+			writer:   ResultWriter{Format: OutputPlugin},
+			expected: "[WARNING] CPU\n| load=90%;80;95;0;100 'last run'=U\n\n",
+		},
+		{
+			writer: ResultWriter{Format: OutputJSON},
+			expected: `{"exit_code":1,"output":"[WARNING] CPU","perfdata":[` +
+				`{"label":"load","value":90,"uom":"%","warn":"80","crit":"95","min":0,"max":100},` +
+				`{"label":"last run","value":null}]}` + "\n",
+		},
+		{
+			writer: ResultWriter{
+				Format:    OutputIcingaAPI,
+				Submitter: Submitter{Host: "agent", Service: "cpu", CheckSource: "agent"},
+			},
+			expected: `{"exit_status":1,"plugin_output":"[WARNING] CPU",` +
+				`"performance_data":["load=90%;80;95;0;100","'last run'=U"],"check_source":"agent",` +
+				`"type":"Service","filter":"host.name==host_name && service.name==service_name",` +
+				`"filter_vars":{"host_name":"agent","service_name":"cpu"}}` + "\n",
+		},
+		{
+			writer: ResultWriter{Format: OutputIcingaAPI, Submitter: Submitter{Host: "agent"}},
+			expected: `{"exit_status":0,"plugin_output":"[WARNING] CPU",` +
+				`"performance_data":["load=90%;80;95;0;100","'last run'=U"],` +
+				`"type":"Host","filter":"host.name==host_name","filter_vars":{"host_name":"agent"}}` + "\n",
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.writer.Format, func(t *testing.T) {
+			var output bytes.Buffer
+
+			assert.NoError(t, test.writer.Write(&output, result))
+			assert.Equal(t, test.expected, output.String())
+		})
+	}
+
+	var output bytes.Buffer
+
+	err := ResultWriter{Format: OutputJSON}.Write(&output, &APICheckResult{CheckResult: "[OK] fine"})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"exit_code":0,"output":"[OK] fine","perfdata":[]}`+"\n", output.String())
+
+	err = ResultWriter{Format: "xml"}.Write(&output, result)
+	assert.ErrorContains(t, err, "unknown output format")
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/NETWAYS/go-check"
+)
+
+// PerfdataUnknown is the value of perfdata that could not be determined.
+const PerfdataUnknown = "U"
+
+// ErrInvalidPerfdata is returned for perfdata that does not follow the plugin guidelines.
+var ErrInvalidPerfdata = errors.New("invalid perfdata")
+
+// perfdataNumberRe matches a number, where a comma is accepted as decimal separator from localized systems.
+var perfdataNumberRe = regexp.MustCompile(`^[-+]?(?:\d+[.,]?\d*|[.,]\d+)(?:[eE][-+]?\d+)?`)
+
+// Perfdata is a single performance data entry as defined by the plugin guidelines:
+//
+//	'label'=value[UOM];[warn];[crit];[min];[max]
+//
+// See https://www.monitoring-plugins.org/doc/guidelines.html#AEN201
+type Perfdata struct {
+	Label string `json:"label"`
+	// Value is nil, when the value is unknown (U).
+	Value *float64 `json:"value"`
+	UOM   string   `json:"uom,omitempty"`
+	// Warn and Crit are ranges, like 10, 10:, ~:10, 10:20 or @10:20.
+	Warn string   `json:"warn,omitempty"`
+	Crit string   `json:"crit,omitempty"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+}
+
+// PerfdataList renders multiple Perfdata separated by spaces.
+type PerfdataList []Perfdata
+
+// ParsePerfdata parses and normalises a single perfdata entry.
+func ParsePerfdata(s string) (p Perfdata, err error) {
+	label, rest, err := parsePerfdataLabel(strings.TrimSpace(s))
+	if err != nil {
+		return
+	}
+
+	p.Label = label
+
+	fields := strings.Split(rest, ";")
+	if len(fields) > 5 {
+		return p, fmt.Errorf("%w: too many fields", ErrInvalidPerfdata)
+	}
+
+	// pad to all fields, as trailing ones can be omitted
+	fields = append(fields, make([]string, 5-len(fields))...)
+
+	p.Value, p.UOM, err = parsePerfdataValue(fields[0])
+	if err != nil {
+		return
+	}
+
+	if p.Warn, err = parsePerfdataRange(fields[1]); err != nil {
+		return p, fmt.Errorf("warning %w", err)
+	}
+
+	if p.Crit, err = parsePerfdataRange(fields[2]); err != nil {
+		return p, fmt.Errorf("critical %w", err)
+	}
+
+	if p.Min, err = parsePerfdataLimit(fields[3]); err != nil {
+		return p, fmt.Errorf("min %w", err)
+	}
+
+	if p.Max, err = parsePerfdataLimit(fields[4]); err != nil {
+		return p, fmt.Errorf("max %w", err)
+	}
+
+	return
+}
+
+// ParsePerfdataList parses all perfdata in s, separated by whitespace.
+//
+// Invalid entries are skipped and returned as errors.
+func ParsePerfdataList(s string) (list PerfdataList, errs []error) {
+	for _, entry := range splitPerfdata(s) {
+		p, err := ParsePerfdata(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry, err))
+			continue
+		}
+
+		list = append(list, p)
+	}
+
+	return
+}
+
+// String renders the perfdata, quoting the label when necessary.
+func (p Perfdata) String() string {
+	var s strings.Builder
+
+	if strings.ContainsAny(p.Label, " \t'=") {
+		s.WriteString("'" + strings.ReplaceAll(p.Label, "'", "''") + "'")
+	} else {
+		s.WriteString(p.Label)
+	}
+
+	s.WriteString("=")
+
+	if p.Value == nil {
+		s.WriteString(PerfdataUnknown)
+	} else {
+		s.WriteString(formatPerfdataNumber(*p.Value) + p.UOM)
+	}
+
+	fields := []string{p.Warn, p.Crit, "", ""}
+
+	for i, limit := range []*float64{p.Min, p.Max} {
+		if limit != nil {
+			fields[2+i] = formatPerfdataNumber(*limit)
+		}
+	}
+
+	for _, field := range fields {
+		s.WriteString(";" + field)
+	}
+
+	return strings.TrimRight(s.String(), ";")
+}
+
+func (l PerfdataList) String() string {
+	return strings.Join(l.Strings(), " ")
+}
+
+// Strings renders every entry on its own.
+func (l PerfdataList) Strings() []string {
+	entries := make([]string, 0, len(l))
+
+	for _, p := range l {
+		entries = append(entries, p.String())
+	}
+
+	return entries
+}
+
+// parsePerfdataLabel splits the label, quoted with single quotes or not, from the rest after =.
+func parsePerfdataLabel(s string) (label, rest string, err error) {
+	if strings.HasPrefix(s, "'") {
+		var (
+			l      strings.Builder
+			closed bool
+		)
+
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				l.WriteByte(s[i])
+				continue
+			}
+
+			// a doubled quote is a quote inside the label
+			if i+1 < len(s) && s[i+1] == '\'' {
+				l.WriteByte('\'')
+				i++
+
+				continue
+			}
+
+			if i+1 == len(s) || s[i+1] != '=' {
+				return "", "", fmt.Errorf("%w: expected = after label", ErrInvalidPerfdata)
+			}
+
+			label, rest, closed = l.String(), s[i+2:], true
+
+			break
+		}
+
+		if !closed {
+			return "", "", fmt.Errorf("%w: missing closing quote of label", ErrInvalidPerfdata)
+		}
+	} else {
+		var found bool
+
+		label, rest, found = strings.Cut(s, "=")
+		if !found {
+			return "", "", fmt.Errorf("%w: missing =", ErrInvalidPerfdata)
+		}
+
+		if strings.ContainsAny(label, " \t'") {
+			return "", "", fmt.Errorf("%w: label must be quoted", ErrInvalidPerfdata)
+		}
+	}
+
+	if strings.TrimSpace(label) == "" {
+		return "", "", fmt.Errorf("%w: empty label", ErrInvalidPerfdata)
+	}
+
+	return label, rest, nil
+}
+
+// parsePerfdataValue splits value and unit of measurement.
+func parsePerfdataValue(s string) (value *float64, uom string, err error) {
+	if s == PerfdataUnknown {
+		return nil, "", nil
+	}
+
+	number := perfdataNumberRe.FindString(s)
+	if number == "" {
+		return nil, "", fmt.Errorf("%w: value is not a number", ErrInvalidPerfdata)
+	}
+
+	value, err = parsePerfdataLimit(number)
+	if err != nil {
+		return nil, "", fmt.Errorf("value %w", err)
+	}
+
+	uom = s[len(number):]
+
+	for _, r := range uom {
+		if !unicode.IsLetter(r) && r != '%' {
+			return nil, "", fmt.Errorf("%w: invalid unit of measurement %q", ErrInvalidPerfdata, uom)
+		}
+	}
+
+	return value, uom, nil
+}
+
+// parsePerfdataRange validates a warning or critical range and normalises the decimal separator.
+func parsePerfdataRange(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	s = strings.ReplaceAll(s, ",", ".")
+
+	if _, err := check.ParseThreshold(s); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidPerfdata, err)
+	}
+
+	return s, nil
+}
+
+// parsePerfdataLimit parses min, max or the value itself, nil when empty.
+func parsePerfdataLimit(s string) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if perfdataNumberRe.FindString(s) != s {
+		return nil, fmt.Errorf("%w: %q is not a number", ErrInvalidPerfdata, s)
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPerfdata, err)
+	}
+
+	return &value, nil
+}
+
+func formatPerfdataNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// splitPerfdata splits s at whitespace outside of quoted labels.
+func splitPerfdata(s string) (entries []string) {
+	var (
+		entry  strings.Builder
+		quoted bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if entry.Len() > 0 {
+				entries = append(entries, entry.String())
+				entry.Reset()
+			}
+
+			continue
+		}
+
+		entry.WriteRune(r)
+	}
+
+	if entry.Len() > 0 {
+		entries = append(entries, entry.String())
+	}
+
+	return
+}
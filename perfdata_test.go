@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestParsePerfdata(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected Perfdata
+		output   string
+	}{
+		{
+			input:    "'load'=90%;80;95;0;100",
+			expected: Perfdata{Label: "load", Value: float(90), UOM: "%", Warn: "80", Crit: "95", Min: float(0), Max: float(100)},
+			output:   "load=90%;80;95;0;100",
+		},
+		{
+			input:    "'C: used space'=12.5GB;;@10:20",
+			expected: Perfdata{Label: "C: used space", Value: float(12.5), UOM: "GB", Crit: "@10:20"},
+			output:   "'C: used space'=12.5GB;;@10:20",
+		},
+		{
+			input:    "'it''s'=U",
+			expected: Perfdata{Label: "it's"},
+			output:   "'it''s'=U",
+		},
+		{
+			input:    "'temp'=-1,5C;~:30,5;;-10;",
+			expected: Perfdata{Label: "temp", Value: float(-1.5), UOM: "C", Warn: "~:30.5", Min: float(-10)},
+			output:   "temp=-1.5C;~:30.5;;-10",
+		},
+		{
+			input:    "uptime=1e3s;10:",
+			expected: Perfdata{Label: "uptime", Value: float(1000), UOM: "s", Warn: "10:"},
+			output:   "uptime=1000s;10:",
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.input, func(t *testing.T) {
+			p, err := ParsePerfdata(test.input)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, p)
+			assert.Equal(t, test.output, p.String())
+		})
+	}
+}
+
+func TestParsePerfdataInvalid(t *testing.T) {
+	for _, input := range []string{
+		"load",
+		"=1",
+		"''=1",
+		"'load=1",
+		"'load'1",
+		"my load=1",
+		"load=",
+		"load=abc",
+		"load=1 %",
+		"load=1%;80;95;0;100;5",
+		"load=1;x",
+		"load=1;;80:x",
+		"load=1;;;a",
+		"load=1;;;;1,2,3",
+	} {
+		_, err := ParsePerfdata(input)
+		assert.ErrorIs(t, err, ErrInvalidPerfdata, input)
+	}
+}
+
+func TestParsePerfdataList(t *testing.T) {
+	list, errs := ParsePerfdataList("'a b'=1 broken  c=2c\t'd'=U")
+	assert.Equal(t, PerfdataList{
+		{Label: "a b", Value: float(1)},
+		{Label: "c", Value: float(2), UOM: "c"},
+		{Label: "d"},
+	}, list)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "broken")
+
+	assert.Equal(t, "'a b'=1 c=2c d=U", list.String())
+}
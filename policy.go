@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrCommandNotAllowed is returned for commands rejected by the CommandPolicy.
+var ErrCommandNotAllowed = errors.New("command is not allowed")
+
+// CommandPolicy restricts the commands forwarded to the API with glob patterns, like Invoke-IcingaCheck*.
+//
+// Patterns match case-insensitive, as PowerShell does for command names. Deny wins over Allow,
+// and without any Allow pattern all commands not denied are allowed.
+type CommandPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Validate all patterns.
+func (p CommandPolicy) Validate() error {
+	for _, pattern := range append(append([]string{}, p.Allow...), p.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// Check returns ErrCommandNotAllowed when command is denied, or not allowed by any pattern.
+func (p CommandPolicy) Check(command string) error {
+	if pattern, ok := matchCommandPattern(p.Deny, command); ok {
+		return fmt.Errorf("%w: %s matches denied pattern %s", ErrCommandNotAllowed, command, pattern)
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+
+	if _, ok := matchCommandPattern(p.Allow, command); ok {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s does not match any allowed pattern", ErrCommandNotAllowed, command)
+}
+
+// Executor wraps api, so commands are checked before any request is made.
+func (p CommandPolicy) Executor(api CheckExecutor) CheckExecutor {
+	return policyExecutor{Policy: p, API: api}
+}
+
+type policyExecutor struct {
+	Policy CommandPolicy
+	API    CheckExecutor
+}
+
+func (e policyExecutor) ExecuteCheck(command string, arguments map[string]interface{}, timeout uint32) (*APICheckResult, error) { //nolint:lll
+	if err := e.Policy.Check(command); err != nil {
+		return nil, err
+	}
+
+	return e.API.ExecuteCheck(command, arguments, timeout)
+}
+
+func matchCommandPattern(patterns []string, command string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(command)); ok {
+			return pattern, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandPolicyCheck(t *testing.T) {
+	policy := CommandPolicy{
+		Allow: []string{"Invoke-IcingaCheck*", "Invoke-IcingaProvider?"},
+		Deny:  []string{"Invoke-IcingaCheckScheduledTask"},
+	}
+
+	assert.NoError(t, policy.Validate())
+
+	assert.NoError(t, policy.Check("Invoke-IcingaCheckCPU"))
+	assert.NoError(t, policy.Check("invoke-icingacheckcpu"))
+	assert.NoError(t, policy.Check("Invoke-IcingaProviderA"))
+
+	err := policy.Check("Invoke-IcingaCheckScheduledTask")
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+	assert.ErrorContains(t, err, "matches denied pattern Invoke-IcingaCheckScheduledTask")
+
+	err = policy.Check("Remove-Item")
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+	assert.ErrorContains(t, err, "Remove-Item does not match any allowed pattern")
+
+	// Everything not denied is allowed without allow patterns
+	policy.Allow = nil
+
+	assert.NoError(t, policy.Check("Remove-Item"))
+	assert.ErrorIs(t, policy.Check("INVOKE-ICINGACHECKSCHEDULEDTASK"), ErrCommandNotAllowed)
+
+	policy.Deny = []string{"Invoke-[Icinga"}
+
+	assert.ErrorContains(t, policy.Validate(), `invalid command pattern "Invoke-[Icinga"`)
+}
+
+func TestCommandPolicyExecutor(t *testing.T) {
+	var requests int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"Invoke-IcingaCheckCPU": {"exitcode": 0, "checkresult": "[OK] CPU", "perfdata": {}}}`))
+	}))
+	defer srv.Close()
+
+	api := CommandPolicy{Allow: []string{"Invoke-IcingaCheck*"}}.Executor(RestAPI{URL: srv.URL, Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))})
+
+	_, err := api.ExecuteCheck("Get-Process", map[string]interface{}{}, 10)
+	assert.ErrorIs(t, err, ErrCommandNotAllowed)
+	assert.Equal(t, 0, requests)
+
+	result, err := api.ExecuteCheck("Invoke-IcingaCheckCPU", map[string]interface{}{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "[OK] CPU", result.CheckResult)
+	assert.Equal(t, 1, requests)
+}
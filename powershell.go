@@ -5,58 +5,31 @@ import (
 )
 
 // GetPowershellArgs returns remaining args and parse them as if we were powershell.exe.
-// nolint:gocognit
 func GetPowershellArgs(args []string) (command string, arguments map[string]interface{}) {
-	arguments = map[string]interface{}{}
-	l := len(args)
-
-	for i := 0; i < l; i++ {
-		arg := args[i]
+	line := ParsePowershellCommandLine(args)
 
-		// ignore any flag with double dash (our flags)
-		if strings.HasPrefix(arg, "--") {
-			if i+1 < l && args[i+1][0] != '-' {
-				i++ // skip the next one also
-			}
+	var scriptArguments []PowershellArgument
 
-			continue
-		}
-
-		// retrieve command
-		if strings.EqualFold(arg, "-Command") || strings.EqualFold(arg, "-C") {
-			if i+1 < l && args[i+1][0] != '-' {
-				command = args[i+1]
-				i++
-			}
-
-			continue
+	if line.Script != "" {
+		// Parameters inside the script come first, so arguments on the command line take precedence
+		if call, err := ParsePowershellScript(line.Script); err == nil {
+			command = call.Command
+			scriptArguments = call.Arguments
+		} else {
+			command = ParsePowershellTryCatch(line.Script)
 		}
+	}
 
-		// warning and critical might be ranges
-		if strings.ToLower(arg) == "-warning" || strings.ToLower(arg) == "-critical" {
-			// No matter what happens, the next argument is a threshold value
-			// This is a dirty hack to allow the usage of range expressions which might
-			// begin with '-' (which then might be interpreted as options
-			arguments[arg] = BuildPowershellType(args[i+1])
-			i++
-
-			continue
-		}
+	arguments = make(map[string]interface{}, len(scriptArguments)+len(line.Arguments))
 
-		// all other flags
-		if i+1 >= l || args[i+1][0] == '-' {
-			// next argument is also a flag, so this is a switch
-			arguments[arg] = true
+	for _, argument := range append(scriptArguments, line.Arguments...) {
+		if argument.Switch {
+			arguments[argument.Name] = true
 		} else {
-			arguments[arg] = BuildPowershellType(args[i+1])
-			i++
+			arguments[argument.Name] = BuildPowershellType(argument.Value)
 		}
 	}
 
-	if command != "" {
-		command = ParsePowershellTryCatch(command)
-	}
-
 	return
 }
 
@@ -68,124 +41,65 @@ func BuildPowershellType(value string) interface{} {
 		return true
 	} else if strings.EqualFold(value, `$false`) {
 		return false
+	} else if IsPowershellHashtable(value) {
+		if hashtable, err := ConvertPowershellHashtable(value); err == nil {
+			return hashtable
+		}
 	} else if IsPowershellArray(value) {
-		return ConvertPowershellArray(value)
+		if array, err := ConvertPowershellArray(value); err == nil {
+			return array
+		}
 	}
 
-	value = strings.Trim(value, "\"")
+	// Icinga might quote twice, e.g. "'\TCPv4\Connections Established'"
+	quoted := len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"'
+	if quoted {
+		value = UnquotePowershellString(value)
+	}
 
-	if len(value) >= 6 && value[0:4] == "'\\''" && value[len(value)-4:] == "'\\''" {
+	if len(value) >= 8 && value[0:4] == "'\\''" && value[len(value)-4:] == "'\\''" {
 		return value[4 : len(value)-4]
-	} else if value[0] == '\'' && value[len(value)-1] == '\'' {
-		return value[1 : len(value)-1]
+	} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return UnquotePowershellString(value)
+	} else if quoted {
+		return value
 	}
 
-	return value
+	// only unquoted values are numbers, like in PowerShell
+	return convertPowershellBareword(value)
 }
 
-// ConvertPowershellArray to a golang type.
+// ConvertPowershellArray to a golang type, with every element converted like a scalar value.
 //
 // Examples:
 //
-//	@() -> []string{}
-//	@('abc') -> []string{"abc"}
-//	@('abc','def') -> []string{"abc","def"}
-//
-// nolint: gocognit
-func ConvertPowershellArray(value string) []string {
+//	@() -> []interface{}{}
+//	@('abc') -> []interface{}{"abc"}
+//	@('abc',2,$null) -> []interface{}{"abc", int64(2), nil}
+//	@(@('a','b'),'c') -> []interface{}{[]interface{}{"a", "b"}, "c"}
+//	'abc','def' -> []interface{}{"abc", "def"}
+//	,'abc' -> []interface{}{"abc"}
+func ConvertPowershellArray(value string) ([]interface{}, error) {
 	if value == "@()" || len(value) == 0 {
-		return []string{}
+		return []interface{}{}, nil
 	}
 
-	if string(value[0]) == `@` {
-		// strip array beginning and end
-		value = value[2 : len(value)-1]
+	result, err := ParsePowershellExpression(value)
+	if err != nil {
+		return nil, err
 	}
 
-	// Am I inside of a string
-	insideString := false
-
-	// Should the current character be escaped
-	escapingMode := false
-
-	// Which kind of quotes are we using right now? (Could be " or ')
-	quoteMode := ``
-	result := []string{}
-
-	// Remember position
-	marker := 0
-
-	for i := range value {
-		if value[i] == '"' && !escapingMode {
-			if insideString && quoteMode == `"` {
-				insideString = false
-				quoteMode = ``
-			} else {
-				quoteMode = `"`
-				insideString = true
-			}
-
-			continue
-		}
-
-		if value[i] == '\'' && !escapingMode {
-			if insideString && quoteMode == `'` {
-				insideString = false
-				quoteMode = ``
-			} else {
-				quoteMode = `'`
-				insideString = true
-			}
-
-			continue
-		}
-
-		if value[i] == ',' && !insideString {
-			if value[i-1] == ',' {
-				// Two consecutive commas
-				result = append(result, "")
-			} else {
-				result = append(result, unquoteString(value[marker:i]))
-			}
-			// Point to char after comma
-			marker = i + 1
-
-			continue
-		}
-
-		if value[i] == '\\' && !escapingMode {
-			escapingMode = true
-			continue
-		}
-
-		if escapingMode {
-			escapingMode = false
-			continue
-		}
+	if list, ok := result.([]interface{}); ok {
+		return list, nil
 	}
 
-	// There might be a rest remaining
-	if marker != len(value) {
-		result = append(result, unquoteString(value[marker:]))
-	}
-
-	return result
-}
-
-func unquoteString(s string) string {
-	if len(s) <= 1 {
-		return s
-	}
-
-	if ((s[0]) == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'') {
-		return s[1 : len(s)-1]
-	}
-
-	return s
+	return []interface{}{result}, nil
 }
 
 // ParsePowershellTryCatch parses the actual command from a try/catch PowerShell code snippet.
 //
+// This is the fallback for snippets ParsePowershellScript can not understand, the last word is used as command.
+//
 // Examples:
 //
 //	 try { Use-Icinga -Minimal; } catch { <# something #> exit 3; };
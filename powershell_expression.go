@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// powershellExpressionParser parses the literal subset of PowerShell expressions,
+// as used for arguments of Icinga for Windows checks.
+//
+// Supported are quoted strings, barewords, numbers, $null/$true/$false, arrays @(...) or 'a','b'
+// and hashtables @{...}.
+type powershellExpressionParser struct {
+	input string
+	pos   int
+}
+
+// ConvertPowershellHashtable to a golang map, with nested arrays and hashtables converted as well.
+//
+// Examples:
+//
+//	@{} -> map[string]interface{}{}
+//	@{ Key = 'Value'; Other = 1 } -> map[string]interface{}{"Key": "Value", "Other": int64(1)}
+//	@{ List = @('a','b') } -> map[string]interface{}{"List": []interface{}{"a", "b"}}
+func ConvertPowershellHashtable(value string) (map[string]interface{}, error) {
+	p := &powershellExpressionParser{input: strings.TrimSpace(value)}
+
+	if !strings.HasPrefix(p.input, "@{") {
+		return nil, fmt.Errorf("not a hashtable literal: %s", value)
+	}
+
+	result, err := p.parseHashtable()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		return nil, p.errorf("unexpected trailing content")
+	}
+
+	return result, nil
+}
+
+// ParsePowershellExpression parses a complete value expression, like a scalar, array or hashtable.
+func ParsePowershellExpression(value string) (interface{}, error) {
+	p := &powershellExpressionParser{input: strings.TrimSpace(value)}
+
+	result, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		return nil, p.errorf("unexpected trailing content")
+	}
+
+	return result, nil
+}
+
+// IsPowershellHashtable returns true when the value looks like a hashtable literal.
+func IsPowershellHashtable(s string) bool {
+	s = strings.TrimSpace(s)
+
+	return len(s) >= 3 && strings.HasPrefix(s, "@{") && s[len(s)-1] == '}'
+}
+
+func (p *powershellExpressionParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("could not parse PowerShell expression at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *powershellExpressionParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *powershellExpressionParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *powershellExpressionParser) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(p.input[p.pos:], prefix)
+}
+
+// skipSpace skips blanks, but not statement separators.
+func (p *powershellExpressionParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipSeparators skips blanks, newlines and semicolons between statements.
+func (p *powershellExpressionParser) skipSeparators() {
+	for !p.eof() && strings.IndexByte(" \t\r\n;", p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// parseExpression parses a single value, or a comma separated list of values into an array.
+//
+// A leading comma is the unary array operator, wrapping the following value into an array.
+func (p *powershellExpressionParser) parseExpression() (interface{}, error) {
+	p.skipSpace()
+
+	if p.peek() == ',' {
+		p.pos++
+		p.skipSpace()
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		return []interface{}{value}, nil
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	if p.peek() != ',' {
+		return value, nil
+	}
+
+	list := []interface{}{value}
+
+	for p.peek() == ',' {
+		p.pos++
+		p.skipSpace()
+
+		switch {
+		case p.peek() == ',':
+			// Tolerate consecutive commas as an empty element
+			list = append(list, "")
+			continue
+		case p.eof() || strings.IndexByte(";\r\n)}", p.peek()) >= 0:
+			// Tolerate a trailing comma
+			return list, nil
+		}
+
+		value, err = p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, value)
+
+		p.skipSpace()
+	}
+
+	return list, nil
+}
+
+func (p *powershellExpressionParser) parseValue() (interface{}, error) {
+	switch {
+	case p.eof():
+		return nil, p.errorf("unexpected end of expression")
+	case p.hasPrefix("@{"):
+		return p.parseHashtable()
+	case p.hasPrefix("@("):
+		return p.parseArray()
+	case p.peek() == '\'' || p.peek() == '"':
+		return p.parseString()
+	}
+
+	word := p.parseBareword()
+	if word == "" {
+		return nil, p.errorf("unexpected character %q", p.peek())
+	}
+
+	return convertPowershellBareword(word), nil
+}
+
+// parseArray parses @(...), where every statement inside is unrolled into the resulting array.
+func (p *powershellExpressionParser) parseArray() ([]interface{}, error) {
+	p.pos += 2 // @(
+
+	result := []interface{}{}
+
+	for {
+		p.skipSeparators()
+
+		if p.eof() {
+			return nil, p.errorf("missing closing ) of array")
+		}
+
+		if p.peek() == ')' {
+			p.pos++
+			return result, nil
+		}
+
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		if list, ok := value.([]interface{}); ok {
+			result = append(result, list...)
+		} else {
+			result = append(result, value)
+		}
+	}
+}
+
+// parseHashtable parses @{ Key = Value; ... } with statements separated by semicolons or newlines.
+func (p *powershellExpressionParser) parseHashtable() (map[string]interface{}, error) {
+	p.pos += 2 // @{
+
+	result := map[string]interface{}{}
+
+	for {
+		p.skipSeparators()
+
+		if p.eof() {
+			return nil, p.errorf("missing closing } of hashtable")
+		}
+
+		if p.peek() == '}' {
+			p.pos++
+			return result, nil
+		}
+
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+
+		if p.peek() != '=' {
+			return nil, p.errorf("missing = after hashtable key %q", key)
+		}
+
+		p.pos++
+
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		result[key] = value
+
+		p.skipSpace()
+
+		if !p.eof() && strings.IndexByte(";\r\n}", p.peek()) < 0 {
+			return nil, p.errorf("unexpected character %q after hashtable value", p.peek())
+		}
+	}
+}
+
+func (p *powershellExpressionParser) parseKey() (string, error) {
+	if p.peek() == '\'' || p.peek() == '"' {
+		return p.parseString()
+	}
+
+	start := p.pos
+
+	for !p.eof() && strings.IndexByte(" \t\r\n=;}", p.peek()) < 0 {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return "", p.errorf("missing hashtable key")
+	}
+
+	return p.input[start:p.pos], nil
+}
+
+// parseString parses a single or double quoted string, including its escapes.
+func (p *powershellExpressionParser) parseString() (string, error) {
+	quote := p.peek()
+	start := p.pos
+	p.pos++
+
+	for !p.eof() {
+		c := p.peek()
+
+		switch {
+		case c == '`' && quote == '"':
+			p.pos += 2
+		case c == '\\' && quote == '"' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '"':
+			// Escaped quote left over from the Windows command line, kept as it is
+			p.pos += 2
+		case c == quote && p.pos+1 < len(p.input) && p.input[p.pos+1] == quote:
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			return UnquotePowershellString(p.input[start:p.pos]), nil
+		default:
+			p.pos++
+		}
+	}
+
+	p.pos = start
+
+	return "", p.errorf("missing closing %c of string", quote)
+}
+
+// parseBareword reads an unquoted value up to the next delimiter.
+func (p *powershellExpressionParser) parseBareword() string {
+	start := p.pos
+
+	for !p.eof() && strings.IndexByte(" \t\r\n,;)}", p.peek()) < 0 {
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+// convertPowershellBareword to a golang type, knowing the automatic variables $null, $true and $false,
+// numeric literals and type casts.
+func convertPowershellBareword(word string) interface{} {
+	switch strings.ToLower(word) {
+	case "$null":
+		return nil
+	case "$true":
+		return true
+	case "$false":
+		return false
+	}
+
+	if number, ok := ParsePowershellNumber(word); ok {
+		return number
+	}
+
+	if value, ok := ConvertPowershellCast(word); ok {
+		return value
+	}
+
+	return word
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	powershellDecimalPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+	powershellHexPattern     = regexp.MustCompile(`^[+-]?0[xX][0-9a-fA-F]+$`)
+	powershellCastPattern    = regexp.MustCompile(`^\[\s*([A-Za-z0-9.]+)\s*\](.*)$`)
+)
+
+// powershellSizeSuffixes are the multipliers PowerShell knows for numeric literals, e.g. 1kb == 1024.
+var powershellSizeSuffixes = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"tb", 1 << 40},
+	{"pb", 1 << 50},
+}
+
+// ParsePowershellNumber parses a numeric literal like PowerShell does in argument mode.
+//
+// Integers are returned as int64, anything with a fraction or exponent as float64.
+// Type suffixes like 1d or 1l are not supported on purpose, since Icinga for Windows
+// uses such values as time spans, threshold ranges like 10:20 are no numbers either.
+//
+// Examples:
+//
+//	30 -> int64(30)
+//	-1.5 -> float64(-1.5)
+//	0x1F -> int64(31)
+//	2KB -> int64(2048)
+func ParsePowershellNumber(s string) (interface{}, bool) {
+	var multiplier int64 = 1
+
+	lower := strings.ToLower(s)
+
+	for _, size := range powershellSizeSuffixes {
+		if len(lower) > len(size.suffix) && strings.HasSuffix(lower, size.suffix) {
+			multiplier = size.multiplier
+			s = s[:len(s)-len(size.suffix)]
+
+			break
+		}
+	}
+
+	if powershellHexPattern.MatchString(s) {
+		negative := s[0] == '-'
+		digits := strings.TrimLeft(s, "+-")[2:]
+
+		i, err := strconv.ParseInt(digits, 16, 64)
+		if err != nil {
+			return nil, false
+		}
+
+		if negative {
+			i = -i
+		}
+
+		return multiplyPowershellNumber(i, multiplier)
+	}
+
+	if !powershellDecimalPattern.MatchString(s) {
+		return nil, false
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return multiplyPowershellNumber(i, multiplier)
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	f *= float64(multiplier)
+
+	// Integral values with a size suffix stay integers, e.g. 1.5kb == 1536
+	if multiplier > 1 && f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+		return int64(f), true
+	}
+
+	return f, true
+}
+
+func multiplyPowershellNumber(i, multiplier int64) (interface{}, bool) {
+	if multiplier == 1 {
+		return i, true
+	}
+
+	if i > math.MaxInt64/multiplier || i < math.MinInt64/multiplier {
+		return float64(i) * float64(multiplier), true
+	}
+
+	return i * multiplier, true
+}
+
+// ConvertPowershellCast applies a type cast like [int]'30' or [string]30 to its value.
+//
+// Unknown types and values that can not be converted are returned unchanged, with ok set to false.
+func ConvertPowershellCast(s string) (value interface{}, ok bool) {
+	match := powershellCastPattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil, false
+	}
+
+	operand := UnquotePowershellString(strings.TrimSpace(match[2]))
+
+	switch strings.TrimPrefix(strings.ToLower(match[1]), "system.") {
+	case "string":
+		return operand, true
+	case "int", "int32", "int64", "long":
+		number, isNumber := ParsePowershellNumber(operand)
+		if !isNumber {
+			return nil, false
+		}
+
+		if f, isFloat := number.(float64); isFloat {
+			// PowerShell uses banker's rounding for casts, [int]2.5 == 2
+			return int64(math.RoundToEven(f)), true
+		}
+
+		return number, true
+	case "double", "float", "single", "decimal":
+		number, isNumber := ParsePowershellNumber(operand)
+		if !isNumber {
+			return nil, false
+		}
+
+		if i, isInt := number.(int64); isInt {
+			return float64(i), true
+		}
+
+		return number, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePowershellNumber(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"30", int64(30)},
+		{"-5", int64(-5)},
+		{"+7", int64(7)},
+		{"007", int64(7)},
+		{"1.5", 1.5},
+		{"-0.25", -0.25},
+		{".5", 0.5},
+		{"1e3", 1000.0},
+		{"0x1F", int64(31)},
+		{"-0x10", int64(-16)},
+		{"1KB", int64(1024)},
+		{"2mb", int64(2 << 20)},
+		{"1.5kb", int64(1536)},
+		{"0x1GB", int64(1 << 30)},
+		{"1PB", int64(1 << 50)},
+		{"99999999999999999999", 1e20},
+	}
+
+	for _, test := range testcases {
+		actual, ok := ParsePowershellNumber(test.value)
+		assert.True(t, ok, test.value)
+		assert.Equal(t, test.expected, actual, test.value)
+	}
+
+	for _, value := range []string{"", "-", "abc", "10:20", "@5:10", "~:10", "10:", "1d", "-1d", "1.2.3", "10%", "kb", "0x", "1e", "NaN", "Inf"} {
+		_, ok := ParsePowershellNumber(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestConvertPowershellCast(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"[int]30", int64(30)},
+		{"[int]'30'", int64(30)},
+		{`[Int32]"0x10"`, int64(16)},
+		{"[int]2.5", int64(2)},
+		{"[int]3.5", int64(4)},
+		{"[long]1kb", int64(1024)},
+		{"[double]2", 2.0},
+		{"[System.Double]'1.5'", 1.5},
+		{"[string]30", "30"},
+		{"[string]'a'", "a"},
+	}
+
+	for _, test := range testcases {
+		actual, ok := ConvertPowershellCast(test.value)
+		assert.True(t, ok, test.value)
+		assert.Equal(t, test.expected, actual, test.value)
+	}
+
+	for _, value := range []string{"30", "[int]abc", "[datetime]'2021-01-01'", "[int"} {
+		_, ok := ConvertPowershellCast(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestBuildPowershellTypeNumbers(t *testing.T) {
+	assert.Equal(t, int64(2), BuildPowershellType("2"))
+	assert.Equal(t, int64(-3600), BuildPowershellType("-3600"))
+	assert.Equal(t, 0.5, BuildPowershellType("0.5"))
+	assert.Equal(t, int64(30), BuildPowershellType("[int]'30'"))
+
+	// Quoted values and threshold ranges stay strings
+	assert.Equal(t, "2", BuildPowershellType("'2'"))
+	assert.Equal(t, "2", BuildPowershellType(`"2"`))
+	assert.Equal(t, "10:20", BuildPowershellType("10:20"))
+	assert.Equal(t, "@5:10", BuildPowershellType("@5:10"))
+	assert.Equal(t, "-5:80", BuildPowershellType("-5:80"))
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// powershellCheckPrefix is the prefix of all check plugins of Icinga for Windows.
+const powershellCheckPrefix = "Invoke-IcingaCheck"
+
+// ErrNoPluginCall is returned when a script contains no call of an Icinga for Windows plugin.
+var ErrNoPluginCall = errors.New("no plugin call found in PowerShell script")
+
+// PowershellScriptCall is the plugin call found inside a -Command script, with its inline parameters.
+type PowershellScriptCall struct {
+	Command   string
+	Arguments []PowershellArgument
+}
+
+type powershellScriptTokenKind int
+
+const (
+	scriptTokenWord powershellScriptTokenKind = iota
+	scriptTokenSeparator
+	scriptTokenBlockStart
+	scriptTokenBlockEnd
+	scriptTokenPipe
+)
+
+type powershellScriptToken struct {
+	kind powershellScriptTokenKind
+	text string
+}
+
+// ParsePowershellScript finds the plugin call inside the script passed via -Command.
+//
+// This understands the subset of PowerShell used by Icinga CheckCommands: try/catch blocks,
+// script blocks like & { ... }, pipelines, Exit-IcingaExecutePlugin -Command 'X' and direct
+// calls of Invoke-IcingaCheck* plugins. Any parameters written inline are returned as well.
+// When multiple calls are found, the last one wins.
+//
+// Examples:
+//
+//	try { Use-Icinga -Minimal; } catch { exit 3; }; Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckCPU'
+//	& { Use-Icinga; Invoke-IcingaCheckCPU -Warning 80 | Out-String }
+func ParsePowershellScript(script string) (call PowershellScriptCall, err error) {
+	tokens, err := tokenizePowershellScript(script)
+	if err != nil {
+		return
+	}
+
+	found := false
+
+	for _, statement := range splitPowershellStatements(tokens) {
+		for _, segment := range statement {
+			if c, ok := parsePowershellPluginCall(segment); ok {
+				call = c
+				found = true
+
+				// only the first plugin of a pipeline is relevant
+				break
+			}
+		}
+	}
+
+	if !found {
+		return call, ErrNoPluginCall
+	}
+
+	return call, nil
+}
+
+// parsePowershellPluginCall checks if a single command invocation calls a plugin.
+func parsePowershellPluginCall(words []string) (call PowershellScriptCall, ok bool) {
+	// ignore variable assignments, like $result = Invoke-IcingaCheckCPU
+	if len(words) > 2 && strings.HasPrefix(words[0], "$") && words[1] == "=" {
+		words = words[2:]
+	}
+
+	if len(words) == 0 {
+		return
+	}
+
+	name := UnquotePowershellString(words[0])
+	line := ParsePowershellCommandLine(words[1:])
+
+	switch {
+	case strings.EqualFold(name, "Exit-IcingaExecutePlugin"):
+		if line.Script == "" {
+			return
+		}
+
+		call.Command = UnquotePowershellString(line.Script)
+	case len(name) > len(powershellCheckPrefix) && strings.EqualFold(name[:len(powershellCheckPrefix)], powershellCheckPrefix):
+		call.Command = name
+	default:
+		return
+	}
+
+	call.Arguments = line.Arguments
+
+	return call, true
+}
+
+// splitPowershellStatements groups tokens into statements, each split into the segments of a pipeline.
+//
+// Blocks only separate statements, but catch and finally blocks are skipped completely,
+// since they never contain the plugin call.
+func splitPowershellStatements(tokens []powershellScriptToken) (statements [][][]string) {
+	var (
+		statement [][]string
+		segment   []string
+	)
+
+	flush := func() {
+		if len(segment) > 0 {
+			statement = append(statement, segment)
+		}
+
+		if len(statement) > 0 {
+			statements = append(statements, statement)
+		}
+
+		statement, segment = nil, nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch token.kind {
+		case scriptTokenWord:
+			keyword := strings.ToLower(token.text)
+
+			if len(segment) == 0 && (keyword == "catch" || keyword == "finally") {
+				i = skipPowershellBlock(tokens, i)
+				continue
+			}
+
+			// keywords and operators that only introduce a block
+			if len(segment) == 0 && (keyword == "try" || keyword == "&" || keyword == ".") {
+				continue
+			}
+
+			segment = append(segment, token.text)
+		case scriptTokenPipe:
+			if len(segment) > 0 {
+				statement = append(statement, segment)
+			}
+
+			segment = nil
+		default:
+			flush()
+		}
+	}
+
+	flush()
+
+	return
+}
+
+// skipPowershellBlock returns the index of the token closing the next block, e.g. catch [Exception] { ... }.
+func skipPowershellBlock(tokens []powershellScriptToken, i int) int {
+	depth := 0
+
+	for ; i < len(tokens); i++ {
+		switch tokens[i].kind {
+		case scriptTokenBlockStart:
+			depth++
+		case scriptTokenBlockEnd:
+			depth--
+
+			if depth <= 0 {
+				return i
+			}
+		}
+	}
+
+	return i
+}
+
+// tokenizePowershellScript splits a script into words, separators, blocks and pipes.
+//
+// Quoted strings, (...), @(...) and @{...} are kept together as a single word, comments are dropped.
+//
+// nolint:gocognit
+func tokenizePowershellScript(script string) (tokens []powershellScriptToken, err error) {
+	var (
+		word  strings.Builder
+		depth int
+	)
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenWord, text: word.String()})
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		switch {
+		case c == '\'' || c == '"':
+			end := findPowershellStringEnd(script, i)
+			if end < 0 {
+				return nil, fmt.Errorf("missing closing %c of string at position %d", c, i)
+			}
+
+			word.WriteString(script[i : end+1])
+			i = end
+		case c == '<' && i+1 < len(script) && script[i+1] == '#':
+			end := strings.Index(script[i+2:], "#>")
+			if end < 0 {
+				return nil, fmt.Errorf("missing end of comment at position %d", i)
+			}
+
+			i += end + 3
+		case c == '#' && word.Len() == 0 && depth == 0:
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+
+			i += end - 1
+		case c == '(' || (c == '{' && (depth > 0 || (word.Len() > 0 && script[i-1] == '@'))):
+			depth++
+
+			word.WriteByte(c)
+		case (c == ')' || c == '}') && depth > 0:
+			depth--
+
+			word.WriteByte(c)
+		case depth > 0:
+			word.WriteByte(c)
+		case c == ' ' || c == '\t':
+			flush()
+		case c == ';' || c == '\r' || c == '\n':
+			flush()
+
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenSeparator, text: string(c)})
+		case c == '{':
+			flush()
+
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenBlockStart, text: "{"})
+		case c == '}':
+			flush()
+
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenBlockEnd, text: "}"})
+		case c == '|':
+			flush()
+
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenPipe, text: "|"})
+		case c == '&' && word.Len() == 0:
+			tokens = append(tokens, powershellScriptToken{kind: scriptTokenWord, text: "&"})
+		default:
+			word.WriteByte(c)
+		}
+	}
+
+	if depth > 0 {
+		return nil, fmt.Errorf("missing closing parenthesis in script")
+	}
+
+	flush()
+
+	return tokens, nil
+}
+
+// findPowershellStringEnd returns the index of the quote closing the string starting at start.
+func findPowershellStringEnd(s string, start int) int {
+	quote := s[start]
+
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '`' && quote == '"':
+			i++
+		case s[i] == quote && i+1 < len(s) && s[i+1] == quote:
+			i++
+		case s[i] == quote:
+			return i
+		}
+	}
+
+	return -1
+}
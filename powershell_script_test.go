@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePowershellScript(t *testing.T) {
+	testcases := []struct {
+		name     string
+		script   string
+		expected PowershellScriptCall
+	}{
+		{
+			name:     "exit-plugin",
+			script:   icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckCPU' ",
+			expected: PowershellScriptCall{Command: "Invoke-IcingaCheckCPU"},
+		},
+		{
+			name: "exit-plugin-followed-by-statement",
+			script: "try { Use-Icinga -Minimal; } catch { Write-Output 'Invoke-IcingaCheckFoo'; exit 3; }; " +
+				"Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckCPU' -Warning 80; exit $LASTEXITCODE",
+			expected: PowershellScriptCall{
+				Command:   "Invoke-IcingaCheckCPU",
+				Arguments: []PowershellArgument{{Name: "-Warning", Value: "80"}},
+			},
+		},
+		{
+			name:   "direct-call-with-parameters",
+			script: "Use-Icinga; Invoke-IcingaCheckService -Service @('W32Time', 'Spooler') -Status 'Running' -NoPerfData",
+			expected: PowershellScriptCall{
+				Command: "Invoke-IcingaCheckService",
+				Arguments: []PowershellArgument{
+					{Name: "-Service", Value: "@('W32Time', 'Spooler')"},
+					{Name: "-Status", Value: "'Running'"},
+					{Name: "-NoPerfData", Switch: true},
+				},
+			},
+		},
+		{
+			name:   "script-block",
+			script: "& { Use-Icinga -Minimal; Invoke-IcingaCheckMemory -Warning '80%' }",
+			expected: PowershellScriptCall{
+				Command:   "Invoke-IcingaCheckMemory",
+				Arguments: []PowershellArgument{{Name: "-Warning", Value: "'80%'"}},
+			},
+		},
+		{
+			name:   "pipeline",
+			script: "Use-Icinga\r\nInvoke-IcingaCheckUptime -Critical '20d:' | Out-String | Write-Host",
+			expected: PowershellScriptCall{
+				Command:   "Invoke-IcingaCheckUptime",
+				Arguments: []PowershellArgument{{Name: "-Critical", Value: "'20d:'"}},
+			},
+		},
+		{
+			name:   "hashtable-and-comments",
+			script: "# prepare\nUse-Icinga <# minimal #>; $r = Invoke-IcingaCheckEventlog -Filter @{ LogName = 'System'; Id = 1 }",
+			expected: PowershellScriptCall{
+				Command:   "Invoke-IcingaCheckEventlog",
+				Arguments: []PowershellArgument{{Name: "-Filter", Value: "@{ LogName = 'System'; Id = 1 }"}},
+			},
+		},
+		{
+			name:   "catch-with-type-and-finally",
+			script: "try { Use-Icinga } catch [System.Exception] { Invoke-IcingaCheckFoo } finally { Invoke-IcingaCheckBar }; Invoke-IcingaCheckCPU",
+			expected: PowershellScriptCall{
+				Command: "Invoke-IcingaCheckCPU",
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			call, err := ParsePowershellScript(test.script)
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, call)
+		})
+	}
+
+	for _, script := range []string{"", "Use-Icinga -Minimal", "Exit-IcingaExecutePlugin", "foo bar",
+		"Use-Icinga; Invoke-IcingaForWindowsMigration", "Invoke-IcingaCheck"} {
+		_, err := ParsePowershellScript(script)
+		assert.ErrorIs(t, err, ErrNoPluginCall, script)
+	}
+
+	for _, script := range []string{"Invoke-IcingaCheckCPU -Warning 'abc", "Invoke-IcingaCheckCPU <# abc", "Invoke-IcingaCheckCPU @('a'"} {
+		_, err := ParsePowershellScript(script)
+		assert.Error(t, err, script)
+	}
+}
+
+func TestGetPowershellArgsScriptParameters(t *testing.T) {
+	command, arguments := GetPowershellArgs([]string{
+		"-C", "Use-Icinga; Invoke-IcingaCheckCPU -Warning 80 -Core '_Total'",
+		"-Warning", "90", "-Critical", "95",
+	})
+
+	assert.Equal(t, "Invoke-IcingaCheckCPU", command)
+	assert.Equal(t, map[string]interface{}{
+		"-Warning": int64(90), "-Critical": int64(95), "-Core": "_Total",
+	}, arguments)
+}
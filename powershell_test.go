@@ -34,11 +34,11 @@ func BenchmarkGetPowershellArgs(b *testing.B) {
 func TestGetPowershellArgs(t *testing.T) {
 	command, args := GetPowershellArgs([]string{"-C", "Invoke-IcingaCheckUsedPartitionSpace", "-Warning", "80"})
 	assert.Equal(t, "Invoke-IcingaCheckUsedPartitionSpace", command)
-	assert.Equal(t, map[string]interface{}{"-Warning": "80"}, args)
+	assert.Equal(t, map[string]interface{}{"-Warning": int64(80)}, args)
 
 	command, args = GetPowershellArgs([]string{"-Switch", "-Warning", "80"})
 	assert.Equal(t, "", command)
-	assert.Equal(t, map[string]interface{}{"-Switch": true, "-Warning": "80"}, args)
+	assert.Equal(t, map[string]interface{}{"-Switch": true, "-Warning": int64(80)}, args)
 
 	command, args = GetPowershellArgs([]string{"-Switch"})
 	assert.Equal(t, "", command)
@@ -68,7 +68,7 @@ func TestGetPowershellArgs(t *testing.T) {
 	})
 	assert.Equal(t, "Invoke-IcingaCheckUsedPartitionSpace", command)
 	assert.Equal(t, map[string]interface{}{
-		"-Critical": "95", "-Verbosity": "2", "-Warning": "80", "-Exclude": []string{"abc", "def"}, "-Include": []string{},
+		"-Critical": int64(95), "-Verbosity": int64(2), "-Warning": int64(80), "-Exclude": []interface{}{"abc", "def"}, "-Include": []interface{}{},
 	}, args)
 }
 
@@ -79,8 +79,11 @@ func TestPowershellRangeExpression(t *testing.T) {
 }
 
 func TestPowershellArrayConversionEmpty(t *testing.T) {
-	assert.Equal(t, []string{}, ConvertPowershellArray("@()"))
-	assert.Equal(t, []string{}, ConvertPowershellArray(""))
+	for _, value := range []string{"@()", "", "@( )"} {
+		actual, err := ConvertPowershellArray(value)
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{}, actual)
+	}
 }
 
 func TestPowershellArrayTest(t *testing.T) {
@@ -93,12 +96,43 @@ func TestPowershellArrayTest(t *testing.T) {
 }
 
 func TestPowershellArrayConversion(t *testing.T) {
-	assert.Equal(t, []string{"abc", `de\"f`, "15"}, ConvertPowershellArray(`@('abc',"de\"f",15)`))
-	assert.Equal(t, []string{"abc", `de\"f`, "15"}, ConvertPowershellArray(`'abc',"de\"f",15`))
+	testcases := []struct {
+		value    string
+		expected []interface{}
+	}{
+		{`@('abc',"de\"f",15)`, []interface{}{"abc", `de\"f`, int64(15)}},
+		{`'abc',"de\"f",15`, []interface{}{"abc", `de\"f`, int64(15)}},
+		{`'ASFASDFASF[]}',,"",1523423,1`, []interface{}{"ASFASDFASF[]}", "", "", int64(1523423), int64(1)}},
+		{"@('abc')", []interface{}{"abc"}},
+		{"@(1,2,3)", []interface{}{int64(1), int64(2), int64(3)}},
+		{"@(1.5, -2, 0x10, 1kb)", []interface{}{1.5, int64(-2), int64(16), int64(1024)}},
+		{"@($null,$true,$FALSE,'$null')", []interface{}{nil, true, false, "$null"}},
+		{"@(@('a','b'),'c')", []interface{}{[]interface{}{"a", "b"}, "c"}},
+		{"@(@(1,2))", []interface{}{int64(1), int64(2)}},
+		{"@('a'; 'b'\n'c')", []interface{}{"a", "b", "c"}},
+		{"@(@{ Name = 'a' }, 'b')", []interface{}{map[string]interface{}{"Name": "a"}, "b"}},
+		{"a,b, c", []interface{}{"a", "b", "c"}},
+		{"'a,b','c'", []interface{}{"a,b", "c"}},
+		{",'single'", []interface{}{"single"}},
+		{",@('a','b')", []interface{}{[]interface{}{"a", "b"}}},
+		{"'it''s',\"`\"quoted`\"\"", []interface{}{"it's", `"quoted"`}},
+		{"'a',", []interface{}{"a"}},
+	}
+
+	for _, test := range testcases {
+		actual, err := ConvertPowershellArray(test.value)
+		assert.NoError(t, err, test.value)
+		assert.Equal(t, test.expected, actual, test.value)
+	}
+
+	for _, value := range []string{"@('abc'", "@('abc)", "'a' 'b',c", "@(,)"} {
+		_, err := ConvertPowershellArray(value)
+		assert.Error(t, err, value)
+	}
 
-	assert.Equal(t,
-		[]string{"ASFASDFASF[]}", "", "", "1523423", "1"},
-		ConvertPowershellArray(`'ASFASDFASF[]}',,"",1523423,1`))
+	// Invalid arrays are passed on as they are
+	assert.Equal(t, "@('abc'", BuildPowershellType("@('abc'"))
+	assert.Equal(t, []interface{}{"single"}, BuildPowershellType(",'single'"))
 }
 
 func TestParsePowershellTryCatch(t *testing.T) {
@@ -163,3 +197,52 @@ func TestPowershellQuotes2(t *testing.T) {
 
 	assert.Equal(t, expected_args, arguments)
 }
+
+func TestPowershellHashtableConversion(t *testing.T) {
+	testcases := []struct {
+		value    string
+		expected map[string]interface{}
+	}{
+		{
+			value:    "@{}",
+			expected: map[string]interface{}{},
+		},
+		{
+			value:    "@{ Key = 'Value'; Other = 1 }",
+			expected: map[string]interface{}{"Key": "Value", "Other": int64(1)},
+		},
+		{
+			value:    "@{'Quoted Key'=\"a;b\";Enabled=$true;Missing=$null}",
+			expected: map[string]interface{}{"Quoted Key": "a;b", "Enabled": true, "Missing": nil},
+		},
+		{
+			value:    "@{\r\n  Include = @('W32Time', 'Spooler')\r\n  Exclude = 'a', 'b'\r\n}",
+			expected: map[string]interface{}{"Include": []interface{}{"W32Time", "Spooler"}, "Exclude": []interface{}{"a", "b"}},
+		},
+		{
+			value: "@{ Filter = @{ LogName = 'System'; Id = @(1, 2) }; Empty = @() }",
+			expected: map[string]interface{}{
+				"Filter": map[string]interface{}{"LogName": "System", "Id": []interface{}{int64(1), int64(2)}},
+				"Empty":  []interface{}{},
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		actual, err := ConvertPowershellHashtable(test.value)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, actual)
+
+		assert.Equal(t, test.expected, BuildPowershellType(test.value))
+	}
+}
+
+func TestPowershellHashtableConversionInvalid(t *testing.T) {
+	for _, value := range []string{"@{", "@{ Key }", "@{ Key = 'abc }", "@{ Key = 1 } foo", "@{ = 1 }", "abc"} {
+		_, err := ConvertPowershellHashtable(value)
+		assert.Error(t, err, value)
+	}
+
+	// Invalid hashtables are passed on as they are
+	assert.Equal(t, "@{ Key }", BuildPowershellType("@{ Key }"))
+}
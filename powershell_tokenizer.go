@@ -0,0 +1,256 @@
+package main
+
+import (
+	"strings"
+)
+
+// PowershellTokenKind classifies a single command line argument as powershell.exe would see it.
+type PowershellTokenKind int
+
+const (
+	// PowershellTokenValue is a plain value, e.g. a threshold like 80, -5:80 or @('a','b').
+	PowershellTokenValue PowershellTokenKind = iota
+	// PowershellTokenParameter is a named parameter like -Warning, optionally with an inline value -Warning:80.
+	PowershellTokenParameter
+	// PowershellTokenCommand is -Command or -C, introducing the script text.
+	PowershellTokenCommand
+	// PowershellTokenConnectorFlag is one of our own double dash flags, which PowerShell never sees.
+	PowershellTokenConnectorFlag
+)
+
+// PowershellToken is a single classified argument.
+type PowershellToken struct {
+	Kind PowershellTokenKind
+	// Raw argument as passed on the command line.
+	Raw string
+	// Name of a parameter including the dash, e.g. -Warning.
+	Name string
+	// Value of a -Param:value argument, only valid when Inline is set.
+	Value  string
+	Inline bool
+}
+
+// PowershellArgument is a parameter bound to its value, or a switch without any value.
+type PowershellArgument struct {
+	Name   string
+	Value  string
+	Switch bool
+}
+
+// PowershellCommandLine is the parsed result of a powershell.exe command line.
+type PowershellCommandLine struct {
+	// Script text passed via -Command, e.g. a try/catch block or a script block.
+	Script     string
+	Arguments  []PowershellArgument
+	Positional []string
+}
+
+// powershellHostParameters are flags of powershell.exe itself, mapped to whether they expect a value.
+//
+// They are only honored in front of -Command, everything after it belongs to the script.
+var powershellHostParameters = map[string]bool{
+	"-noprofile":         false,
+	"-nologo":            false,
+	"-noninteractive":    false,
+	"-noexit":            false,
+	"-sta":               false,
+	"-mta":               false,
+	"-executionpolicy":   true,
+	"-ep":                true,
+	"-windowstyle":       true,
+	"-inputformat":       true,
+	"-outputformat":      true,
+	"-version":           true,
+	"-psconsolefile":     true,
+	"-configurationname": true,
+}
+
+// TokenizePowershellArguments classifies every argument as parameter, value, command or connector flag.
+//
+// A parameter starts with a dash followed by a letter, so negative numbers and ranges like -10:20
+// are values, no matter which parameter they follow.
+func TokenizePowershellArguments(args []string) []PowershellToken {
+	tokens := make([]PowershellToken, 0, len(args))
+
+	for _, arg := range args {
+		tokens = append(tokens, classifyPowershellArgument(arg))
+	}
+
+	return tokens
+}
+
+func classifyPowershellArgument(arg string) PowershellToken {
+	token := PowershellToken{Kind: PowershellTokenValue, Raw: arg}
+
+	if strings.HasPrefix(arg, "--") {
+		token.Kind = PowershellTokenConnectorFlag
+		token.Name = arg
+
+		return token
+	}
+
+	if len(arg) < 2 || arg[0] != '-' || !isPowershellParameterStart(arg[1]) {
+		return token
+	}
+
+	token.Kind = PowershellTokenParameter
+	token.Name = arg
+
+	if i := strings.IndexByte(arg, ':'); i > 0 {
+		token.Name = arg[:i]
+		token.Value = arg[i+1:]
+		token.Inline = true
+	}
+
+	if strings.EqualFold(token.Name, "-Command") || strings.EqualFold(token.Name, "-C") {
+		token.Kind = PowershellTokenCommand
+	}
+
+	return token
+}
+
+func isPowershellParameterStart(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || b == '?'
+}
+
+// ParsePowershellCommandLine binds parameters to their values as powershell.exe would do.
+//
+// Examples:
+//
+//	-C 'Invoke-IcingaCheckCPU' -Warning 80 -> Script "Invoke-IcingaCheckCPU", -Warning=80
+//	-Warning:-5 -NoPerfData                 -> -Warning=-5, -NoPerfData switch
+//	-NoProfile -C '...' -Critical -10:20    -> host parameter ignored, -Critical=-10:20
+//
+// nolint:gocognit
+func ParsePowershellCommandLine(args []string) (line PowershellCommandLine) {
+	tokens := TokenizePowershellArguments(args)
+	l := len(tokens)
+
+	// Host parameters are only valid in front of the script
+	commandIndex := -1
+
+	for i, token := range tokens {
+		if token.Kind == PowershellTokenCommand {
+			commandIndex = i
+			break
+		}
+	}
+
+	nextIsValue := func(i int) bool {
+		return i+1 < l && tokens[i+1].Kind == PowershellTokenValue
+	}
+
+	for i := 0; i < l; i++ {
+		token := tokens[i]
+
+		switch token.Kind {
+		case PowershellTokenConnectorFlag:
+			// ignore our flags and their value
+			if nextIsValue(i) {
+				i++
+			}
+		case PowershellTokenCommand:
+			if token.Inline {
+				line.Script = token.Value
+			} else if nextIsValue(i) {
+				line.Script = tokens[i+1].Raw
+				i++
+			}
+		case PowershellTokenParameter:
+			if takesValue, ok := powershellHostParameters[strings.ToLower(token.Name)]; ok && i < commandIndex {
+				if takesValue && !token.Inline && nextIsValue(i) {
+					i++
+				}
+
+				continue
+			}
+
+			argument := PowershellArgument{Name: token.Name}
+
+			switch {
+			case token.Inline:
+				argument.Value = token.Value
+			case nextIsValue(i):
+				argument.Value = tokens[i+1].Raw
+				i++
+			default:
+				argument.Switch = true
+			}
+
+			line.Arguments = append(line.Arguments, argument)
+		case PowershellTokenValue:
+			line.Positional = append(line.Positional, token.Raw)
+		}
+	}
+
+	return
+}
+
+// UnquotePowershellString removes one layer of PowerShell quoting from a string literal.
+//
+// Double quoted strings support backtick escapes and doubled quotes, single quoted strings only
+// support doubled quotes. Unquoted values are returned as they are.
+func UnquotePowershellString(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+
+	switch {
+	case s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	case s[0] == '"' && s[len(s)-1] == '"':
+		return unescapePowershellDoubleQuoted(s[1 : len(s)-1])
+	}
+
+	return s
+}
+
+func unescapePowershellDoubleQuoted(s string) string {
+	if !strings.ContainsAny(s, "`\"") {
+		return s
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '`' && i+1 < len(s):
+			i++
+			b.WriteString(powershellEscape(s[i]))
+		case c == '"' && i+1 < len(s) && s[i+1] == '"':
+			i++
+			b.WriteByte('"')
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func powershellEscape(c byte) string {
+	switch c {
+	case '0':
+		return "\x00"
+	case 'a':
+		return "\a"
+	case 'b':
+		return "\b"
+	case 'e':
+		return "\x1b"
+	case 'f':
+		return "\f"
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	case 'v':
+		return "\v"
+	}
+
+	return string(c)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const icingaTryCatch = "try { Use-Icinga -Minimal; } catch { <# something #> exit 3; }; "
+
+func TestTokenizePowershellArguments(t *testing.T) {
+	tokens := TokenizePowershellArguments([]string{
+		"--api", "https://localhost:5668", "-C", "Invoke-IcingaCheckCPU",
+		"-Warning:80", "-Critical", "-10:20", "-5", "-", "", "-NoPerfData",
+	})
+
+	assert.Equal(t, []PowershellToken{
+		{Kind: PowershellTokenConnectorFlag, Raw: "--api", Name: "--api"},
+		{Kind: PowershellTokenValue, Raw: "https://localhost:5668"},
+		{Kind: PowershellTokenCommand, Raw: "-C", Name: "-C"},
+		{Kind: PowershellTokenValue, Raw: "Invoke-IcingaCheckCPU"},
+		{Kind: PowershellTokenParameter, Raw: "-Warning:80", Name: "-Warning", Value: "80", Inline: true},
+		{Kind: PowershellTokenParameter, Raw: "-Critical", Name: "-Critical"},
+		{Kind: PowershellTokenValue, Raw: "-10:20"},
+		{Kind: PowershellTokenValue, Raw: "-5"},
+		{Kind: PowershellTokenValue, Raw: "-"},
+		{Kind: PowershellTokenValue, Raw: ""},
+		{Kind: PowershellTokenParameter, Raw: "-NoPerfData", Name: "-NoPerfData"},
+	}, tokens)
+}
+
+func TestParsePowershellCommandLine(t *testing.T) {
+	line := ParsePowershellCommandLine([]string{
+		"-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", "Invoke-IcingaCheckCPU",
+		"stray", "-Core", "_Total", "-NoPerfData", "-Verbosity:2",
+	})
+
+	assert.Equal(t, "Invoke-IcingaCheckCPU", line.Script)
+	assert.Equal(t, []string{"stray"}, line.Positional)
+	assert.Equal(t, []PowershellArgument{
+		{Name: "-Core", Value: "_Total"},
+		{Name: "-NoPerfData", Switch: true},
+		{Name: "-Verbosity", Value: "2"},
+	}, line.Arguments)
+
+	// Host parameters after the script are handed to the check
+	line = ParsePowershellCommandLine([]string{"-C", "Invoke-IcingaCheckCPU", "-Version", "2"})
+	assert.Equal(t, []PowershellArgument{{Name: "-Version", Value: "2"}}, line.Arguments)
+}
+
+func TestGetPowershellArgsCheckCommands(t *testing.T) {
+	testcases := []struct {
+		name      string
+		args      []string
+		command   string
+		arguments map[string]interface{}
+	}{
+		{
+			name: "cpu",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckCPU' ",
+				"-Warning", "80", "-Critical", "95", "-Core", "'_Total'", "-Verbosity", "0",
+			},
+			command: "Invoke-IcingaCheckCPU",
+			arguments: map[string]interface{}{
+				"-Warning": int64(80), "-Critical": int64(95), "-Core": "_Total", "-Verbosity": int64(0),
+			},
+		},
+		{
+			name: "memory-percent-ranges",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckMemory' ",
+				"-WarningPercent", "~:20", "-CriticalPercent", "@5:10", "-PageFile", "-Verbosity", "2",
+			},
+			command: "Invoke-IcingaCheckMemory",
+			arguments: map[string]interface{}{
+				"-WarningPercent": "~:20", "-CriticalPercent": "@5:10", "-PageFile": true, "-Verbosity": int64(2),
+			},
+		},
+		{
+			name: "partition-space",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckUsedPartitionSpace' ",
+				"-Warning", "80", "-Critical", "95", "-Include", "@()", "-Exclude", "@('C:','D:')",
+				"-IgnoreEmptyChecks", "-SkipUnknown", "-Verbosity", "2",
+			},
+			command: "Invoke-IcingaCheckUsedPartitionSpace",
+			arguments: map[string]interface{}{
+				"-Warning": int64(80), "-Critical": int64(95), "-Include": []interface{}{}, "-Exclude": []interface{}{"C:", "D:"},
+				"-IgnoreEmptyChecks": true, "-SkipUnknown": true, "-Verbosity": int64(2),
+			},
+		},
+		{
+			name: "service",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckService' ",
+				"-Service", "@('W32Time','Spooler')", "-Status", "'Running'", "-FilterStartupType", "@('Automatic')",
+			},
+			command: "Invoke-IcingaCheckService",
+			arguments: map[string]interface{}{
+				"-Service": []interface{}{"W32Time", "Spooler"}, "-Status": "Running", "-FilterStartupType": []interface{}{"Automatic"},
+			},
+		},
+		{
+			name: "eventlog-negative-value",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckEventlog' ",
+				"-LogName", "'System'", "-IncludeEntryType", "@('Error','Warning')", "-After", "-1d",
+				"-DisableTimeCache", "-Critical", "1",
+			},
+			command: "Invoke-IcingaCheckEventlog",
+			arguments: map[string]interface{}{
+				"-LogName": "System", "-IncludeEntryType": []interface{}{"Error", "Warning"}, "-After": "-1d",
+				"-DisableTimeCache": true, "-Critical": int64(1),
+			},
+		},
+		{
+			name: "uptime-negative-range",
+			args: []string{
+				"-C", "Invoke-IcingaCheckUptime", "-Warning", "-10:20", "-Critical:@-5:5", "-Offset", "-3600",
+			},
+			command: "Invoke-IcingaCheckUptime",
+			arguments: map[string]interface{}{
+				"-Warning": "-10:20", "-Critical": "@-5:5", "-Offset": int64(-3600),
+			},
+		},
+		{
+			name: "perfcounter-double-quoted",
+			args: []string{
+				"-C", icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckPerfCounter' ",
+				"-PerfCounter", `"'\Processor(*)\% processor time'"`, "-Warning", "90",
+			},
+			command: "Invoke-IcingaCheckPerfCounter",
+			arguments: map[string]interface{}{
+				"-PerfCounter": `\Processor(*)\% processor time`, "-Warning": int64(90),
+			},
+		},
+		{
+			name: "timesync-backtick-escapes",
+			args: []string{
+				"-C", "Invoke-IcingaCheckTimeSync", "-Server", "\"pool.ntp.org`t\"", "-Warning", "10",
+				"-Timeout", "1000", "-IPV4",
+			},
+			command: "Invoke-IcingaCheckTimeSync",
+			arguments: map[string]interface{}{
+				"-Server": "pool.ntp.org\t", "-Warning": int64(10), "-Timeout": int64(1000), "-IPV4": true,
+			},
+		},
+		{
+			name: "directory-single-quote-escape",
+			args: []string{
+				"-C", "Invoke-IcingaCheckDirectory", "-Path", `'C:\Users\O''Brien'`, "-FileNames", "@('*.txt')",
+				"-Recurse", "-ChangeTimeEqual:'1d'",
+			},
+			command: "Invoke-IcingaCheckDirectory",
+			arguments: map[string]interface{}{
+				"-Path": `C:\Users\O'Brien`, "-FileNames": []interface{}{"*.txt"}, "-Recurse": true, "-ChangeTimeEqual": "1d",
+			},
+		},
+		{
+			name: "powershell-host-flags",
+			args: []string{
+				"-NoProfile", "-NoLogo", "-ExecutionPolicy", "ByPass", "-Command",
+				icingaTryCatch + "Exit-IcingaExecutePlugin -Command 'Invoke-IcingaCheckUsers' ",
+				"-Username", "@()", "-NoPerfData:$true",
+			},
+			command: "Invoke-IcingaCheckUsers",
+			arguments: map[string]interface{}{
+				"-Username": []interface{}{}, "-NoPerfData": true,
+			},
+		},
+		{
+			name: "switch-explicit-false",
+			args: []string{
+				"-C", "Invoke-IcingaCheckFirewall", "-Profile", "@('Domain')", "-Enabled:$false",
+			},
+			command: "Invoke-IcingaCheckFirewall",
+			arguments: map[string]interface{}{
+				"-Profile": []interface{}{"Domain"}, "-Enabled": false,
+			},
+		},
+		{
+			name: "connector-flags-mixed",
+			args: []string{
+				"--api", "https://localhost:5668", "--insecure", "-C", "Invoke-IcingaCheckProcessCount",
+				"-Process", "'svchost'", "-Warning", "$null",
+			},
+			command: "Invoke-IcingaCheckProcessCount",
+			arguments: map[string]interface{}{
+				"-Process": "svchost", "-Warning": nil,
+			},
+		},
+		{
+			name: "trailing-switch-and-empty-value",
+			args: []string{
+				"-C", "Invoke-IcingaCheckBiosSerial", "-Comment", "", "-Verbose",
+			},
+			command: "Invoke-IcingaCheckBiosSerial",
+			arguments: map[string]interface{}{
+				"-Comment": "", "-Verbose": true,
+			},
+		},
+	}
+
+	for _, test := range testcases {
+		t.Run(test.name, func(t *testing.T) {
+			command, arguments := GetPowershellArgs(test.args)
+			assert.Equal(t, test.command, command)
+			assert.Equal(t, test.arguments, arguments)
+		})
+	}
+}
+
+func TestUnquotePowershellString(t *testing.T) {
+	assert.Equal(t, "abc", UnquotePowershellString("abc"))
+	assert.Equal(t, "abc", UnquotePowershellString("'abc'"))
+	assert.Equal(t, "it's", UnquotePowershellString("'it''s'"))
+	assert.Equal(t, "a `n b", UnquotePowershellString("'a `n b'"))
+	assert.Equal(t, "a \n b", UnquotePowershellString("\"a `n b\""))
+	assert.Equal(t, `say "hi"`, UnquotePowershellString("\"say `\"hi`\"\""))
+	assert.Equal(t, `say "hi"`, UnquotePowershellString(`"say ""hi"""`))
+	assert.Equal(t, "`", UnquotePowershellString("\"``\""))
+	assert.Equal(t, "'", UnquotePowershellString("'"))
+	assert.Equal(t, "", UnquotePowershellString(""))
+}
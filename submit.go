@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSubmitAPI = "https://localhost:5665"
+
+	processCheckResultPath = "/v1/actions/process-check-result"
+)
+
+// ErrNoSubmitHost is returned when no host is known to submit a check result for.
+var ErrNoSubmitHost = errors.New("no host to submit the check result for")
+
+// ProcessCheckResult is the body of the process-check-result action of the Icinga 2 API.
+type ProcessCheckResult struct {
+	ExitStatus      int      `json:"exit_status"`
+	PluginOutput    string   `json:"plugin_output"`
+	PerformanceData []string `json:"performance_data,omitempty"`
+	CheckSource     string   `json:"check_source,omitempty"`
+
+	// Type, Filter and FilterVars select the object, when the query of the request does not.
+	Type       string            `json:"type,omitempty"`
+	Filter     string            `json:"filter,omitempty"`
+	FilterVars map[string]string `json:"filter_vars,omitempty"`
+}
+
+// processCheckResultResponse is returned by the Icinga 2 API, with one result per matched object.
+type processCheckResultResponse struct {
+	Results []struct {
+		Code   float64 `json:"code"`
+		Status string  `json:"status"`
+	} `json:"results"`
+}
+
+// Submitter posts check results passively to the Icinga 2 API.
+type Submitter struct {
+	URL string
+	// Host and Service the result is submitted for, a host check result without Service.
+	Host        string
+	Service     string
+	CheckSource string
+	Client      *http.Client
+	Logger      *slog.Logger
+}
+
+// NewProcessCheckResult builds the action body for result.
+//
+// Hosts only know UP and DOWN, so like for active host checks OK and WARNING mean UP.
+func (s Submitter) NewProcessCheckResult(result *APICheckResult) ProcessCheckResult {
+	exitStatus := result.ExitCode
+
+	if s.Service == "" {
+		if exitStatus <= 1 {
+			exitStatus = 0
+		} else {
+			exitStatus = 1
+		}
+	}
+
+	return ProcessCheckResult{
+		ExitStatus:      exitStatus,
+		PluginOutput:    strings.TrimSpace(result.CheckResult),
+		PerformanceData: result.ParsedPerfdata().Strings(),
+		CheckSource:     s.CheckSource,
+	}
+}
+
+// NewProcessCheckResultPayload builds the action body for result, including the filter selecting the object,
+// so it can be posted to the API as it is.
+func (s Submitter) NewProcessCheckResultPayload(result *APICheckResult) ProcessCheckResult {
+	payload := s.NewProcessCheckResult(result)
+
+	if s.Service == "" {
+		payload.Type = "Host"
+		payload.Filter = "host.name==host_name"
+		payload.FilterVars = map[string]string{"host_name": s.Host}
+	} else {
+		payload.Type = "Service"
+		payload.Filter = "host.name==host_name && service.name==service_name"
+		payload.FilterVars = map[string]string{"host_name": s.Host, "service_name": s.Service}
+	}
+
+	return payload
+}
+
+// Submit posts result as process-check-result action to the Icinga 2 API.
+func (s Submitter) Submit(result *APICheckResult, timeout uint32) error {
+	if s.Host == "" {
+		return ErrNoSubmitHost
+	}
+
+	body, err := json.Marshal(s.NewProcessCheckResult(result))
+	if err != nil {
+		return fmt.Errorf("could not build JSON body: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	requestURL := strings.TrimSuffix(s.URL, "/") + processCheckResultPath + "?" + s.filter()
+
+	s.Logger.Debug("submitting check result", "body", string(body), "url", requestURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("timeout during submit of check result: %w", err)
+		}
+
+		return fmt.Errorf("submitting check result failed: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read submit result: %w", err)
+	}
+
+	s.Logger.Debug("received submit response", "body", string(data))
+
+	if resp.StatusCode != http.StatusOK {
+		return &APIStatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	var response processCheckResultResponse
+
+	err = json.Unmarshal(data, &response)
+	if err != nil {
+		return fmt.Errorf("could not parse submit result JSON: %w", err)
+	}
+
+	if len(response.Results) == 0 {
+		return fmt.Errorf("check result was not processed for any object")
+	}
+
+	for _, r := range response.Results {
+		if r.Code != http.StatusOK {
+			return fmt.Errorf("check result was not processed code=%d: %s", int(r.Code), r.Status)
+		}
+	}
+
+	return nil
+}
+
+// filter returns the query selecting the host or service object.
+func (s Submitter) filter() string {
+	if s.Service == "" {
+		return "host=" + url.QueryEscape(s.Host)
+	}
+
+	return "service=" + url.QueryEscape(s.Host+"!"+s.Service)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubmitterSubmit(t *testing.T) {
+	ca, caKey, _, _ := writeTestCertificate(t, "Icinga CA", nil, nil)
+	_, _, certFile, keyFile := writeTestCertificate(t, "agent.example.com", ca, caKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+
+	var (
+		query  string
+		client string
+		body   ProcessCheckResult
+	)
+
+	// Stand-in for the Icinga 2 API
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, processCheckResultPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+
+		query = r.URL.RawQuery
+		client = r.TLS.PeerCertificates[0].Subject.CommonName
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		_, _ = w.Write([]byte(`{"results":[{"code":200.0,"status":"Successfully processed check result for object 'agent!cpu'."}]}`))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+
+	serverCA := filepath.Join(t.TempDir(), "ca.crt")
+	_ = os.WriteFile(serverCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+
+	config := &Config{
+		CAFile:      serverCA,
+		CertName:    "agent.example.com",
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		SubmitAPI:   srv.URL,
+		SubmitHost:  "agent.example.com",
+		CheckSource: "agent.example.com",
+	}
+
+	result := &APICheckResult{ExitCode: 1, CheckResult: "[WARNING] CPU\n", Perfdata: APIPerfdataList{"'load'=90%;80;95"}}
+
+	// Service
+	config.SubmitService = "cpu"
+
+	submitter, err := config.NewSubmitter(slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	assert.NoError(t, err)
+
+	err = submitter.Submit(result, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "service=agent.example.com%21cpu", query)
+	assert.Equal(t, "agent.example.com", client)
+	assert.Equal(t, ProcessCheckResult{
+		ExitStatus:      1,
+		PluginOutput:    "[WARNING] CPU",
+		PerformanceData: []string{"load=90%;80;95"},
+		CheckSource:     "agent.example.com",
+	}, body)
+
+	// Host, where WARNING is still UP
+	submitter.Service = ""
+
+	err = submitter.Submit(result, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, "host=agent.example.com", query)
+	assert.Equal(t, 0, body.ExitStatus)
+
+	err = submitter.Submit(&APICheckResult{ExitCode: 2, CheckResult: "[CRITICAL] down"}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, body.ExitStatus)
+
+	submitter.Host = ""
+
+	err = submitter.Submit(result, 10)
+	assert.ErrorIs(t, err, ErrNoSubmitHost)
+}
+
+func TestSubmitterSubmitError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("host") == "unknown" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":404.0,"status":"No objects found."}`))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"results":[{"code":500.0,"status":"Object is not a host."}]}`))
+	}))
+	defer srv.Close()
+
+	submitter := Submitter{URL: srv.URL, Host: "unknown", Logger: slog.New(slog.NewTextHandler(os.Stdout, nil))}
+	result := &APICheckResult{ExitCode: 0, CheckResult: "[OK] fine"}
+
+	err := submitter.Submit(result, 10)
+
+	var statusErr *APIStatusError
+
+	assert.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+
+	submitter.Host = "agent"
+
+	err = submitter.Submit(result, 10)
+	assert.EqualError(t, err, "check result was not processed code=500: Object is not a host.")
+}